@@ -0,0 +1,198 @@
+// This file was generated by counterfeiter
+package adminfakes
+
+import (
+	"sync"
+
+	"github.com/SAP/aker/admin"
+	"github.com/SAP/aker/router"
+)
+
+type FakeRouter struct {
+	EndpointsStub        func() []router.EndpointStatus
+	endpointsMutex       sync.RWMutex
+	endpointsArgsForCall []struct{}
+	endpointsReturns     struct {
+		result1 []router.EndpointStatus
+	}
+	RestartPluginStub        func(id string, position int) error
+	restartPluginMutex       sync.RWMutex
+	restartPluginArgsForCall []struct {
+		id       string
+		position int
+	}
+	restartPluginReturns struct {
+		result1 error
+	}
+	DrainStub        func(id string) error
+	drainMutex       sync.RWMutex
+	drainArgsForCall []struct {
+		id string
+	}
+	drainReturns struct {
+		result1 error
+	}
+	ResumeStub        func(id string) error
+	resumeMutex       sync.RWMutex
+	resumeArgsForCall []struct {
+		id string
+	}
+	resumeReturns struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeRouter) Endpoints() []router.EndpointStatus {
+	fake.endpointsMutex.Lock()
+	fake.endpointsArgsForCall = append(fake.endpointsArgsForCall, struct{}{})
+	fake.recordInvocation("Endpoints", []interface{}{})
+	fake.endpointsMutex.Unlock()
+	if fake.EndpointsStub != nil {
+		return fake.EndpointsStub()
+	} else {
+		return fake.endpointsReturns.result1
+	}
+}
+
+func (fake *FakeRouter) EndpointsCallCount() int {
+	fake.endpointsMutex.RLock()
+	defer fake.endpointsMutex.RUnlock()
+	return len(fake.endpointsArgsForCall)
+}
+
+func (fake *FakeRouter) EndpointsReturns(result1 []router.EndpointStatus) {
+	fake.EndpointsStub = nil
+	fake.endpointsReturns = struct {
+		result1 []router.EndpointStatus
+	}{result1}
+}
+
+func (fake *FakeRouter) RestartPlugin(id string, position int) error {
+	fake.restartPluginMutex.Lock()
+	fake.restartPluginArgsForCall = append(fake.restartPluginArgsForCall, struct {
+		id       string
+		position int
+	}{id, position})
+	fake.recordInvocation("RestartPlugin", []interface{}{id, position})
+	fake.restartPluginMutex.Unlock()
+	if fake.RestartPluginStub != nil {
+		return fake.RestartPluginStub(id, position)
+	} else {
+		return fake.restartPluginReturns.result1
+	}
+}
+
+func (fake *FakeRouter) RestartPluginCallCount() int {
+	fake.restartPluginMutex.RLock()
+	defer fake.restartPluginMutex.RUnlock()
+	return len(fake.restartPluginArgsForCall)
+}
+
+func (fake *FakeRouter) RestartPluginArgsForCall(i int) (string, int) {
+	fake.restartPluginMutex.RLock()
+	defer fake.restartPluginMutex.RUnlock()
+	return fake.restartPluginArgsForCall[i].id, fake.restartPluginArgsForCall[i].position
+}
+
+func (fake *FakeRouter) RestartPluginReturns(result1 error) {
+	fake.RestartPluginStub = nil
+	fake.restartPluginReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRouter) Drain(id string) error {
+	fake.drainMutex.Lock()
+	fake.drainArgsForCall = append(fake.drainArgsForCall, struct {
+		id string
+	}{id})
+	fake.recordInvocation("Drain", []interface{}{id})
+	fake.drainMutex.Unlock()
+	if fake.DrainStub != nil {
+		return fake.DrainStub(id)
+	} else {
+		return fake.drainReturns.result1
+	}
+}
+
+func (fake *FakeRouter) DrainCallCount() int {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	return len(fake.drainArgsForCall)
+}
+
+func (fake *FakeRouter) DrainArgsForCall(i int) string {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	return fake.drainArgsForCall[i].id
+}
+
+func (fake *FakeRouter) DrainReturns(result1 error) {
+	fake.DrainStub = nil
+	fake.drainReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRouter) Resume(id string) error {
+	fake.resumeMutex.Lock()
+	fake.resumeArgsForCall = append(fake.resumeArgsForCall, struct {
+		id string
+	}{id})
+	fake.recordInvocation("Resume", []interface{}{id})
+	fake.resumeMutex.Unlock()
+	if fake.ResumeStub != nil {
+		return fake.ResumeStub(id)
+	} else {
+		return fake.resumeReturns.result1
+	}
+}
+
+func (fake *FakeRouter) ResumeCallCount() int {
+	fake.resumeMutex.RLock()
+	defer fake.resumeMutex.RUnlock()
+	return len(fake.resumeArgsForCall)
+}
+
+func (fake *FakeRouter) ResumeArgsForCall(i int) string {
+	fake.resumeMutex.RLock()
+	defer fake.resumeMutex.RUnlock()
+	return fake.resumeArgsForCall[i].id
+}
+
+func (fake *FakeRouter) ResumeReturns(result1 error) {
+	fake.ResumeStub = nil
+	fake.resumeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRouter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.endpointsMutex.RLock()
+	defer fake.endpointsMutex.RUnlock()
+	fake.restartPluginMutex.RLock()
+	defer fake.restartPluginMutex.RUnlock()
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	fake.resumeMutex.RLock()
+	defer fake.resumeMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeRouter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ admin.Router = new(FakeRouter)
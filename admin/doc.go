@@ -0,0 +1,14 @@
+// Package admin implements Aker's admin API. It lets operators inspect the
+// loaded endpoints and their plugin processes, restart single plugins,
+// reload the configuration and drain endpoints.
+//
+// The API is served on its own listener, separate from the one serving
+// proxied requests, and speaks JSON:
+//
+//	GET  /endpoints                                  lists the endpoints
+//	POST /endpoints/drain?endpoint=<id>              drains an endpoint
+//	POST /endpoints/resume?endpoint=<id>             resumes a drained endpoint
+//	POST /plugins/restart?endpoint=<id>&position=<n> restarts a plugin
+//	POST /reload                                     reloads the configuration
+//	GET  /metrics                                    exposes Prometheus metrics
+package admin
@@ -0,0 +1,5 @@
+package admin
+
+import "errors"
+
+var NoAddressErr = errors.New("neither address nor socket path specified for the admin listener")
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SAP/aker/endpoint"
+	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/router"
+	"github.com/SAP/gologger"
+)
+
+//go:generate counterfeiter . Router
+
+// Router gives access to the endpoints served by Aker.
+type Router interface {
+	Endpoints() []router.EndpointStatus
+	RestartPlugin(id string, position int) error
+	Drain(id string) error
+	Resume(id string) error
+}
+
+//go:generate counterfeiter . Reloader
+
+// Reloader wraps the basic Reload method.
+type Reloader interface {
+	// Reload should load the configuration again and apply it.
+	Reload() error
+}
+
+// NewHandler returns a http.Handler serving the admin API. When metrics is not
+// nil, it is served at /metrics. When token is not empty, requests have to
+// carry it in an "Authorization: Bearer" header.
+func NewHandler(r Router, reloader Reloader, metrics http.Handler, token string) http.Handler {
+	h := &handler{router: r, reloader: reloader}
+	mux := http.NewServeMux()
+	if metrics != nil {
+		mux.Handle("/metrics", metrics)
+	}
+	mux.HandleFunc("/endpoints", h.method("GET", h.listEndpoints))
+	mux.HandleFunc("/endpoints/drain", h.method("POST", h.drain))
+	mux.HandleFunc("/endpoints/resume", h.method("POST", h.resume))
+	mux.HandleFunc("/plugins/restart", h.method("POST", h.restartPlugin))
+	mux.HandleFunc("/reload", h.method("POST", h.reload))
+	if token == "" {
+		return mux
+	}
+	return &authenticator{handler: mux, token: []byte("Bearer " + token)}
+}
+
+type authenticator struct {
+	handler http.Handler
+	token   []byte
+}
+
+func (a *authenticator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	authorization := []byte(req.Header.Get("Authorization"))
+	if subtle.ConstantTimeCompare(authorization, a.token) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="aker"`)
+		writeError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	a.handler.ServeHTTP(w, req)
+}
+
+type handler struct {
+	router   Router
+	reloader Reloader
+}
+
+func (h *handler) method(method string, handle http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
+		handle(w, req)
+	}
+}
+
+func (h *handler) listEndpoints(w http.ResponseWriter, req *http.Request) {
+	now := time.Now()
+	statuses := h.router.Endpoints()
+	endpoints := make([]endpointView, len(statuses))
+	for index, status := range statuses {
+		endpoints[index] = newEndpointView(status, now)
+	}
+	writeJSON(w, http.StatusOK, endpoints)
+}
+
+func (h *handler) drain(w http.ResponseWriter, req *http.Request) {
+	h.respond(w, h.router.Drain(req.URL.Query().Get("endpoint")))
+}
+
+func (h *handler) resume(w http.ResponseWriter, req *http.Request) {
+	h.respond(w, h.router.Resume(req.URL.Query().Get("endpoint")))
+}
+
+func (h *handler) restartPlugin(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	position, err := strconv.Atoi(query.Get("position"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid plugin position: "+strconv.Quote(query.Get("position")))
+		return
+	}
+	h.respond(w, h.router.RestartPlugin(query.Get("endpoint"), position))
+}
+
+func (h *handler) reload(w http.ResponseWriter, req *http.Request) {
+	h.respond(w, h.reloader.Reload())
+}
+
+func (h *handler) respond(w http.ResponseWriter, err error) {
+	if err == plugin.BuiltinRestartErr {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	switch err.(type) {
+	case nil:
+		writeJSON(w, http.StatusOK, struct{}{})
+	case router.UnknownEndpointError, endpoint.InvalidPluginPositionError:
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorView{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		gologger.Warnf("Failed to write admin API response: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/SAP/aker/admin"
+	"github.com/SAP/aker/admin/adminfakes"
+	"github.com/SAP/aker/endpoint"
+	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/router"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+
+	var fakeRouter *adminfakes.FakeRouter
+	var fakeReloader *adminfakes.FakeReloader
+	var metrics http.Handler
+	var token string
+	var handler http.Handler
+
+	serve := func(method, target, authorization string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "http://localhost"+target, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	BeforeEach(func() {
+		fakeRouter = new(adminfakes.FakeRouter)
+		fakeReloader = new(adminfakes.FakeReloader)
+		metrics = nil
+		token = ""
+	})
+
+	JustBeforeEach(func() {
+		handler = NewHandler(fakeRouter, fakeReloader, metrics, token)
+	})
+
+	Describe("GET /metrics", func() {
+		It("should not be served without metrics", func() {
+			rr := serve("GET", "/metrics", "")
+			Ω(rr.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		Context("when metrics are specified", func() {
+			BeforeEach(func() {
+				metrics = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.Write([]byte("aker_up 1\n"))
+				})
+			})
+
+			It("should serve them", func() {
+				rr := serve("GET", "/metrics", "")
+				Ω(rr.Code).Should(Equal(http.StatusOK))
+				Ω(rr.Body.String()).Should(Equal("aker_up 1\n"))
+			})
+		})
+	})
+
+	Describe("GET /endpoints", func() {
+		BeforeEach(func() {
+			fakeRouter.EndpointsReturns([]router.EndpointStatus{
+				{
+					ID: "/api/",
+					Status: endpoint.Status{
+						Source:   "conf.d/api.yml",
+						Path:     "/api/",
+						InFlight: 2,
+						Plugins: []endpoint.PluginStatus{
+							{
+								Name:       "aker-proxy",
+								SocketPath: "/tmp/proxy.sock",
+								Users:      2,
+								Replicas: []plugin.ReplicaStatus{
+									{
+										PID:        42,
+										SocketPath: "/tmp/proxy.sock",
+										StartedAt:  time.Now().Add(-time.Minute),
+										Restarts:   3,
+										Ready:      true,
+									},
+								},
+							},
+						},
+					},
+				},
+			})
+		})
+
+		It("should list the endpoints with their plugin processes", func() {
+			rr := serve("GET", "/endpoints", "")
+			Ω(rr.Code).Should(Equal(http.StatusOK))
+			Ω(rr.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+			var endpoints []map[string]interface{}
+			Ω(json.Unmarshal(rr.Body.Bytes(), &endpoints)).Should(Succeed())
+			Ω(endpoints).Should(HaveLen(1))
+			Ω(endpoints[0]["id"]).Should(Equal("/api/"))
+			Ω(endpoints[0]["source"]).Should(Equal("conf.d/api.yml"))
+			Ω(endpoints[0]["in_flight"]).Should(BeNumerically("==", 2))
+
+			plugins := endpoints[0]["plugins"].([]interface{})
+			Ω(plugins).Should(HaveLen(1))
+			plug := plugins[0].(map[string]interface{})
+			Ω(plug["name"]).Should(Equal("aker-proxy"))
+			Ω(plug["socket_path"]).Should(Equal("/tmp/proxy.sock"))
+			Ω(plug["users"]).Should(BeNumerically("==", 2))
+
+			process := plug["processes"].([]interface{})[0].(map[string]interface{})
+			Ω(process["pid"]).Should(BeNumerically("==", 42))
+			Ω(process["restarts"]).Should(BeNumerically("==", 3))
+			Ω(process["uptime_seconds"]).Should(BeNumerically(">=", 60))
+			Ω(process["ready"]).Should(BeTrue())
+		})
+
+		It("should reject other methods", func() {
+			rr := serve("POST", "/endpoints", "")
+			Ω(rr.Code).Should(Equal(http.StatusMethodNotAllowed))
+			Ω(rr.Header().Get("Allow")).Should(Equal("GET"))
+		})
+	})
+
+	Describe("POST /endpoints/drain", func() {
+		It("should drain the endpoint", func() {
+			rr := serve("POST", "/endpoints/drain?endpoint=/api/", "")
+			Ω(rr.Code).Should(Equal(http.StatusOK))
+			Ω(fakeRouter.DrainCallCount()).Should(Equal(1))
+			Ω(fakeRouter.DrainArgsForCall(0)).Should(Equal("/api/"))
+		})
+
+		Context("when the endpoint is unknown", func() {
+			BeforeEach(func() {
+				fakeRouter.DrainReturns(router.UnknownEndpointError("/unknown"))
+			})
+
+			It("should respond with not found", func() {
+				rr := serve("POST", "/endpoints/drain?endpoint=/unknown", "")
+				Ω(rr.Code).Should(Equal(http.StatusNotFound))
+				Ω(rr.Body.String()).Should(MatchJSON(`{"error": "unknown endpoint: \"/unknown\""}`))
+			})
+		})
+	})
+
+	Describe("POST /endpoints/resume", func() {
+		It("should resume the endpoint", func() {
+			rr := serve("POST", "/endpoints/resume?endpoint=/api/", "")
+			Ω(rr.Code).Should(Equal(http.StatusOK))
+			Ω(fakeRouter.ResumeArgsForCall(0)).Should(Equal("/api/"))
+		})
+	})
+
+	Describe("POST /plugins/restart", func() {
+		It("should restart the plugin", func() {
+			rr := serve("POST", "/plugins/restart?endpoint=/api/&position=1", "")
+			Ω(rr.Code).Should(Equal(http.StatusOK))
+			id, position := fakeRouter.RestartPluginArgsForCall(0)
+			Ω(id).Should(Equal("/api/"))
+			Ω(position).Should(Equal(1))
+		})
+
+		It("should reject an invalid position", func() {
+			rr := serve("POST", "/plugins/restart?endpoint=/api/&position=first", "")
+			Ω(rr.Code).Should(Equal(http.StatusBadRequest))
+			Ω(fakeRouter.RestartPluginCallCount()).Should(BeZero())
+		})
+
+		Context("when the plugin is not in the chain", func() {
+			BeforeEach(func() {
+				fakeRouter.RestartPluginReturns(endpoint.InvalidPluginPositionError(5))
+			})
+
+			It("should respond with not found", func() {
+				rr := serve("POST", "/plugins/restart?endpoint=/api/&position=5", "")
+				Ω(rr.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when the plugin is builtin", func() {
+			BeforeEach(func() {
+				fakeRouter.RestartPluginReturns(plugin.BuiltinRestartErr)
+			})
+
+			It("should respond with conflict", func() {
+				rr := serve("POST", "/plugins/restart?endpoint=/api/&position=1", "")
+				Ω(rr.Code).Should(Equal(http.StatusConflict))
+				Ω(rr.Body.String()).Should(MatchJSON(`{"error": "builtin plugins cannot be restarted"}`))
+			})
+		})
+	})
+
+	Describe("POST /reload", func() {
+		It("should reload the configuration", func() {
+			rr := serve("POST", "/reload", "")
+			Ω(rr.Code).Should(Equal(http.StatusOK))
+			Ω(fakeReloader.ReloadCallCount()).Should(Equal(1))
+		})
+
+		Context("when the reload fails", func() {
+			BeforeEach(func() {
+				fakeReloader.ReloadReturns(errors.New("invalid configuration"))
+			})
+
+			It("should respond with the error", func() {
+				rr := serve("POST", "/reload", "")
+				Ω(rr.Code).Should(Equal(http.StatusInternalServerError))
+				Ω(rr.Body.String()).Should(MatchJSON(`{"error": "invalid configuration"}`))
+			})
+		})
+	})
+
+	Context("when a token is configured", func() {
+		BeforeEach(func() {
+			token = "s3cr3t"
+		})
+
+		It("should reject requests without the token", func() {
+			rr := serve("POST", "/reload", "")
+			Ω(rr.Code).Should(Equal(http.StatusUnauthorized))
+			Ω(rr.Header().Get("WWW-Authenticate")).Should(HavePrefix("Bearer"))
+			Ω(fakeReloader.ReloadCallCount()).Should(BeZero())
+		})
+
+		It("should reject requests with a wrong token", func() {
+			rr := serve("POST", "/reload", "Bearer guess")
+			Ω(rr.Code).Should(Equal(http.StatusUnauthorized))
+		})
+
+		It("should accept requests with the token", func() {
+			rr := serve("POST", "/reload", "Bearer s3cr3t")
+			Ω(rr.Code).Should(Equal(http.StatusOK))
+			Ω(fakeReloader.ReloadCallCount()).Should(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"net"
+	"os"
+
+	"github.com/SAP/aker/config"
+)
+
+// Listen opens the listener configured for the admin API. A unix socket
+// takes precedence over a TCP address. A stale socket file left behind by a
+// previous run is removed first.
+func Listen(cfg config.AdminConfig) (net.Listener, error) {
+	if cfg.SocketPath != "" {
+		if err := os.Remove(cfg.SocketPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", cfg.SocketPath)
+	}
+	if cfg.Address != "" {
+		return net.Listen("tcp", cfg.Address)
+	}
+	return nil, NoAddressErr
+}
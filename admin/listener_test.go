@@ -0,0 +1,51 @@
+package admin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/SAP/aker/admin"
+	"github.com/SAP/aker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listen", func() {
+	It("should listen on TCP", func() {
+		listener, err := Listen(config.AdminConfig{Address: "127.0.0.1:0"})
+		Ω(err).ShouldNot(HaveOccurred())
+		defer listener.Close()
+		Ω(listener.Addr().Network()).Should(Equal("tcp"))
+	})
+
+	Context("when a socket path is specified", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "aker-admin")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should listen on the unix socket, replacing a stale one", func() {
+			socketPath := filepath.Join(dir, "admin.sock")
+			Ω(ioutil.WriteFile(socketPath, nil, 0600)).Should(Succeed())
+
+			listener, err := Listen(config.AdminConfig{Address: "127.0.0.1:0", SocketPath: socketPath})
+			Ω(err).ShouldNot(HaveOccurred())
+			defer listener.Close()
+			Ω(listener.Addr().Network()).Should(Equal("unix"))
+		})
+	})
+
+	It("should fail without an address", func() {
+		_, err := Listen(config.AdminConfig{})
+		Ω(err).Should(Equal(NoAddressErr))
+	})
+})
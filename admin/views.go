@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/SAP/aker/endpoint"
+	"github.com/SAP/aker/router"
+)
+
+type errorView struct {
+	Error string `json:"error"`
+}
+
+type endpointView struct {
+	ID        string       `json:"id"`
+	Source    string       `json:"source,omitempty"`
+	Hosts     []string     `json:"hosts"`
+	Path      string       `json:"path,omitempty"`
+	PathRegex string       `json:"path_regex,omitempty"`
+	Draining  bool         `json:"draining"`
+	InFlight  int          `json:"in_flight"`
+	Plugins   []pluginView `json:"plugins"`
+	Fallback  []pluginView `json:"fallback,omitempty"`
+}
+
+type pluginView struct {
+	Name       string        `json:"name"`
+	SocketPath string        `json:"socket_path"`
+	Processes  []processView `json:"processes"`
+	Builtin    bool          `json:"builtin,omitempty"`
+	Circuit    string        `json:"circuit,omitempty"`
+	// Users is the number of chain positions sharing the plugin. Restarting
+	// a shared plugin restarts it for all of them.
+	Users int `json:"users"`
+}
+
+type processView struct {
+	// PID is zero while the process is not running, e.g. while it waits to
+	// be restarted.
+	PID           int     `json:"pid"`
+	SocketPath    string  `json:"socket_path"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	Restarts      int     `json:"restarts"`
+	Ready         bool    `json:"ready"`
+	InFlight      int     `json:"in_flight"`
+}
+
+func newEndpointView(status router.EndpointStatus, now time.Time) endpointView {
+	return endpointView{
+		ID:        status.ID,
+		Source:    status.Source,
+		Hosts:     status.Hosts,
+		Path:      status.Path,
+		PathRegex: status.PathRegex,
+		Draining:  status.Draining,
+		InFlight:  status.InFlight,
+		Plugins:   newPluginViews(status.Plugins, now),
+		Fallback:  newPluginViews(status.Fallback, now),
+	}
+}
+
+func newPluginViews(plugins []endpoint.PluginStatus, now time.Time) []pluginView {
+	views := make([]pluginView, len(plugins))
+	for index, plug := range plugins {
+		processes := make([]processView, len(plug.Replicas))
+		for replicaIndex, replica := range plug.Replicas {
+			process := processView{
+				PID:        replica.PID,
+				SocketPath: replica.SocketPath,
+				Restarts:   replica.Restarts,
+				Ready:      replica.Ready,
+				InFlight:   replica.InFlight,
+			}
+			if replica.PID != 0 {
+				process.UptimeSeconds = now.Sub(replica.StartedAt).Seconds()
+			}
+			processes[replicaIndex] = process
+		}
+		views[index] = pluginView{
+			Name:       plug.Name,
+			SocketPath: plug.SocketPath,
+			Processes:  processes,
+			Builtin:    plug.Builtin,
+			Circuit:    string(plug.Circuit),
+			Users:      plug.Users,
+		}
+	}
+	return views
+}
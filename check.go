@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SAP/aker/config"
+	"github.com/SAP/aker/endpoint"
+	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/requestid"
+	"github.com/SAP/aker/router"
+	"github.com/SAP/aker/tlsconfig"
+)
+
+// check validates the configuration file without starting anything and
+// writes its problems to out. It returns whether the configuration is valid.
+func check(configPath string, out io.Writer) bool {
+	checked := config.Check(configPath)
+	checkConfig(checked)
+
+	problems := checked.Problems
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	for _, warning := range endpoint.SharingWarnings(checked.Config.Endpoints) {
+		fmt.Fprintf(out, "%s: warning: %s\n", configPath, warning)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "%s: %d problem(s) found\n", configPath, len(problems))
+		return false
+	}
+	fmt.Fprintf(out, "%s: OK\n", configPath)
+	return true
+}
+
+// checkConfig reports the problems that Aker would run into when starting
+// with the configuration.
+func checkConfig(checked *config.Checked) {
+	cfg := checked.Config
+	opener := &plugin.Opener{SearchPath: cfg.Server.PluginPath}
+	if cfg.Server.TLS != nil {
+		if _, err := tlsconfig.New(*cfg.Server.TLS); err != nil {
+			checked.Report(err, "server", "tls")
+		}
+	}
+	if _, err := requestid.New(cfg.Server.RequestID); err != nil {
+		checked.Report(err, "server", "request_id")
+	}
+
+	for _, err := range router.Validate(cfg.Endpoints) {
+		endpointErr := err.(*router.EndpointError)
+		checked.Report(endpointErr.Err, "endpoints", endpointErr.Index)
+	}
+	for endpointIndex, endpointCfg := range cfg.Endpoints {
+		switch err := endpoint.Validate(endpointCfg); err {
+		case nil:
+		case endpoint.NoPluginsErr:
+			checked.Report(err, "endpoints", endpointIndex, "plugins")
+		case endpoint.InvalidChainModeError(endpointCfg.ChainMode):
+			checked.Report(err, "endpoints", endpointIndex, "chain_mode")
+		default:
+			checked.Report(err, "endpoints", endpointIndex, "path")
+		}
+		checkPlugins(checked, opener, endpointCfg.Plugins, "endpoints", endpointIndex, "plugins")
+		checkPlugins(checked, opener, endpointCfg.Fallback, "endpoints", endpointIndex, "fallback")
+	}
+}
+
+// checkPlugins reports the problems with the plugins of a chain, whose
+// references are found at chainPath.
+func checkPlugins(checked *config.Checked, opener *plugin.Opener, references []config.PluginReference, chainPath ...interface{}) {
+	for pluginIndex, reference := range references {
+		path := append(append([]interface{}{}, chainPath...), pluginIndex)
+		switch err := endpoint.ValidatePlugin(reference).(type) {
+		case nil:
+		case *plugin.BuiltinOptionError:
+			checked.Report(err, append(path, err.Option)...)
+		default:
+			checked.Report(err, path...)
+		}
+		if reference.Use != "" && reference.Name == "" {
+			// the definition is missing, which has been reported already
+			continue
+		}
+		if plugin.Registered(reference.Name) {
+			continue
+		}
+		if _, err := opener.LookPath(reference.Name); err != nil {
+			checked.Report(err, append(path, "name")...)
+		}
+		if reference.Dir != "" {
+			if info, err := os.Stat(reference.Dir); err != nil {
+				checked.Report(err, append(path, "dir")...)
+			} else if !info.IsDir() {
+				checked.Report(fmt.Errorf("not a directory: %q", reference.Dir), append(path, "dir")...)
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is an issue found in a configuration file.
+type Problem struct {
+	File string
+	// Line is zero when the location of the problem is not known.
+	Line int
+	Err  error
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %v", p.File, p.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", p.File, p.Line, p.Err)
+}
+
+// Checked is a configuration file loaded by Check, along with the files it
+// includes.
+type Checked struct {
+	Config   Config
+	Problems []Problem
+
+	file string
+	// files holds the positions of the values of each file, and order the
+	// order in which the files have been checked.
+	files map[string]positions
+	order map[string]int
+	// origins are the files and the indexes within them of the endpoints.
+	origins  []origin
+	reported map[string]bool
+}
+
+type origin struct {
+	file  string
+	index int
+}
+
+var syntaxErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// Check loads the configuration file like LoadFromFile, but collects all
+// problems instead of stopping at the first one. It is also stricter: keys
+// that Aker does not know and negative timeouts are problems as well.
+//
+// The returned configuration is decoded as far as possible, so that the
+// callers can report problems they find in it with Report.
+func Check(name string) *Checked {
+	c := &Checked{
+		file:     name,
+		files:    make(map[string]positions),
+		order:    make(map[string]int),
+		reported: make(map[string]bool),
+	}
+	c.checkFile(name, &c.Config)
+	c.addEndpoints(name, c.Config.Endpoints)
+	included := c.checkIncludes(name, c.Config.Include, map[string]bool{absolute(name): true})
+	c.Config.Endpoints = append(c.Config.Endpoints, included...)
+	resolveDefinitions(&c.Config, c.Report)
+
+	c.checkTimeouts()
+	return c
+}
+
+// checkFile decodes the file into the value pointed to by out as far as
+// possible and reports its problems.
+func (c *Checked) checkFile(name string, out interface{}) {
+	c.order[name] = len(c.order)
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		c.add(Problem{File: name, Err: err})
+		return
+	}
+	root, err := parse(content)
+	if err != nil {
+		c.addSyntaxError(name, err)
+		return
+	}
+	if root == nil {
+		return
+	}
+	c.files[name] = locate(root)
+
+	target := reflect.TypeOf(out).Elem()
+	r := &resolver{lookup: os.LookupEnv, report: func(path []interface{}, err error) {
+		c.report(name, path, err)
+	}}
+	r.resolve(root, target)
+	problems := len(c.Problems)
+	c.checkTypes(name, root, target, nil)
+
+	err = root.Decode(out)
+	// type errors have been reported with their locations already
+	if _, ok := err.(*yaml.TypeError); err != nil && !(ok && len(c.Problems) > problems) {
+		c.add(Problem{File: name, Err: err})
+	}
+}
+
+// checkIncludes checks the files included by the named file and returns
+// their endpoints.
+func (c *Checked) checkIncludes(name string, patterns []string, visiting map[string]bool) []Endpoint {
+	var endpoints []Endpoint
+	for index, pattern := range patterns {
+		files, err := expandInclude(filepath.Dir(name), pattern)
+		if err != nil {
+			c.report(name, []interface{}{"include", index}, err)
+			continue
+		}
+		for _, file := range files {
+			key := absolute(file)
+			if visiting[key] {
+				c.report(name, []interface{}{"include", index}, IncludeCycleError(file))
+				continue
+			}
+			f := fragment{}
+			c.checkFile(file, &f)
+			c.addEndpoints(file, f.Endpoints)
+			endpoints = append(endpoints, f.Endpoints...)
+
+			visiting[key] = true
+			endpoints = append(endpoints, c.checkIncludes(file, f.Include, visiting)...)
+			delete(visiting, key)
+		}
+	}
+	return endpoints
+}
+
+func (c *Checked) addEndpoints(name string, endpoints []Endpoint) {
+	setSource(endpoints, name)
+	for index := range endpoints {
+		c.origins = append(c.origins, origin{file: name, index: index})
+	}
+}
+
+// Report adds a problem with the value at the specified path, e.g.
+// "endpoints", 1, "path". The endpoints are counted across all files, and
+// the problems of endpoints are reported in the files defining them. Only
+// the first problem of each value is kept.
+func (c *Checked) Report(err error, path ...interface{}) {
+	if len(path) >= 2 && path[0] == "endpoints" {
+		if index, ok := path[1].(int); ok && index >= 0 && index < len(c.origins) {
+			origin := c.origins[index]
+			local := append([]interface{}{"endpoints", origin.index}, path[2:]...)
+			c.report(origin.file, local, err)
+			return
+		}
+	}
+	c.report(c.file, path, err)
+}
+
+func (c *Checked) report(file string, path []interface{}, err error) {
+	key := file + ":" + pathString(path)
+	if c.reported[key] {
+		return
+	}
+	c.reported[key] = true
+	c.add(Problem{File: file, Line: c.files[file].line(path), Err: err})
+}
+
+// add inserts the problem after the problems of the files checked before
+// its file and of the lines before its line.
+func (c *Checked) add(problem Problem) {
+	index := sort.Search(len(c.Problems), func(index int) bool {
+		other := c.Problems[index]
+		if other.File != problem.File {
+			return c.order[other.File] > c.order[problem.File]
+		}
+		return other.Line > problem.Line
+	})
+	c.Problems = append(c.Problems, Problem{})
+	copy(c.Problems[index+1:], c.Problems[index:])
+	c.Problems[index] = problem
+}
+
+func (c *Checked) addSyntaxError(file string, err error) {
+	match := syntaxErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		c.add(Problem{File: file, Err: err})
+		return
+	}
+	line, _ := strconv.Atoi(match[1])
+	c.add(Problem{File: file, Line: line, Err: fmt.Errorf("%s", match[2])})
+}
+
+// checkTypes reports unknown keys and values that cannot be decoded into
+// the type of their field.
+func (c *Checked) checkTypes(file string, node *yaml.Node, target reflect.Type, path []interface{}) {
+	for target != nil && target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.ShortTag() == "!!null" || target == nil || target.Kind() == reflect.Interface {
+		return
+	}
+
+	switch target.Kind() {
+	case reflect.Struct, reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			c.report(file, path, &InvalidTypeError{Value: nodeValue(node), Type: "mapping"})
+			return
+		}
+		items := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			items = append(items, [2]*yaml.Node{node.Content[index], node.Content[index+1]})
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i][0].Value < items[j][0].Value
+		})
+		for _, item := range items {
+			key, value := item[0], item[1]
+			if key.ShortTag() == "!!merge" {
+				continue
+			}
+			itemPath := appendPath(path, key.Value)
+			itemType := fieldType(target, key.Value)
+			if itemType == nil {
+				c.report(file, itemPath, UnknownKeyError(key.Value))
+				continue
+			}
+			c.checkTypes(file, value, itemType, itemPath)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			c.report(file, path, &InvalidTypeError{Value: nodeValue(node), Type: "sequence"})
+			return
+		}
+		for index, item := range node.Content {
+			c.checkTypes(file, item, target.Elem(), appendPath(path, index))
+		}
+	default:
+		typeName, ok := scalarTypes[target.Kind()]
+		if !ok {
+			return
+		}
+		// a value is valid if the decoder accepts it
+		if node.Decode(reflect.New(target).Interface()) != nil {
+			c.report(file, path, &InvalidTypeError{Value: nodeValue(node), Type: typeName})
+		}
+	}
+}
+
+// scalarTypes names the kinds of scalar fields in problems.
+var scalarTypes = map[reflect.Kind]string{
+	reflect.String:  "string",
+	reflect.Bool:    "boolean",
+	reflect.Int:     "integer",
+	reflect.Int8:    "integer",
+	reflect.Int16:   "integer",
+	reflect.Int32:   "integer",
+	reflect.Int64:   "integer",
+	reflect.Float32: "number",
+	reflect.Float64: "number",
+}
+
+// nodeValue decodes the node for reporting it.
+func nodeValue(node *yaml.Node) interface{} {
+	var value interface{}
+	node.Decode(&value)
+	return value
+}
+
+func (c *Checked) checkTimeouts() {
+	server := c.Config.Server
+	c.checkTimeout(server.ReadTimeout, "server", "read_timeout")
+	c.checkTimeout(server.WriteTimeout, "server", "write_timeout")
+	c.checkTimeout(server.ShutdownTimeout, "server", "shutdown_timeout")
+	c.checkTimeout(server.PluginStopTimeout, "server", "plugin_stop_timeout")
+	for endpointIndex, endpoint := range c.Config.Endpoints {
+		c.checkTimeout(endpoint.Timeout, "endpoints", endpointIndex, "timeout")
+		c.checkPluginTimeouts(endpoint.Plugins, "endpoints", endpointIndex, "plugins")
+		c.checkPluginTimeouts(endpoint.Fallback, "endpoints", endpointIndex, "fallback")
+	}
+}
+
+func (c *Checked) checkPluginTimeouts(references []PluginReference, chainPath ...interface{}) {
+	for pluginIndex, reference := range references {
+		path := append(append([]interface{}{}, chainPath...), pluginIndex)
+		c.checkTimeout(reference.ReadyTimeout, append(path, "ready_timeout")...)
+		c.checkTimeout(reference.ResponseTimeout, append(path, "response_timeout")...)
+		c.checkTimeout(reference.RestartPolicy.Backoff, append(path, "restart_policy", "backoff")...)
+		c.checkTimeout(reference.RestartPolicy.MaxBackoff, append(path, "restart_policy", "max_backoff")...)
+		c.checkTimeout(reference.CircuitBreaker.OpenTimeout, append(path, "circuit_breaker", "open_timeout")...)
+	}
+}
+
+func (c *Checked) checkTimeout(seconds int, path ...interface{}) {
+	if seconds < 0 {
+		c.Report(InvalidTimeoutError(seconds), path...)
+	}
+}
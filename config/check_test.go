@@ -0,0 +1,163 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/SAP/aker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Check", func() {
+	var dir string
+	var name string
+	var checked *Checked
+
+	check := func(content string) {
+		Ω(ioutil.WriteFile(name, []byte(content), 0600)).Should(Succeed())
+		checked = Check(name)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "aker-config")
+		Ω(err).ShouldNot(HaveOccurred())
+		name = filepath.Join(dir, "config.yml")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should report no problems for a valid configuration", func() {
+		check(`
+server:
+  port: 8080
+endpoints:
+  - path: /
+    plugins:
+      - name: proxy
+        configuration:
+          anything: [goes, here]
+`)
+		Ω(checked.Problems).Should(BeEmpty())
+		Ω(checked.Config.Server.Port).Should(Equal(8080))
+		Ω(checked.Config.Endpoints[0].Plugins[0].Name).Should(Equal("proxy"))
+	})
+
+	It("should report unknown keys and invalid values with their lines", func() {
+		check(`server:
+  port: eighty
+  read_timeout: -1
+  tls_config: {}
+endpoints:
+- path: /
+  plugin:
+    - name: proxy
+- path: /api/
+  audit: maybe
+  timeout: -3
+  plugins:
+    - name: proxy
+      restart_policy:
+        max_backof: 30
+      ready_timeout: -5
+      response_timeout: -2
+`)
+		Ω(checked.Problems).Should(Equal([]Problem{
+			{File: name, Line: 2, Err: &InvalidTypeError{Value: "eighty", Type: "integer"}},
+			{File: name, Line: 3, Err: InvalidTimeoutError(-1)},
+			{File: name, Line: 4, Err: UnknownKeyError("tls_config")},
+			{File: name, Line: 7, Err: UnknownKeyError("plugin")},
+			{File: name, Line: 10, Err: &InvalidTypeError{Value: "maybe", Type: "boolean"}},
+			{File: name, Line: 11, Err: InvalidTimeoutError(-3)},
+			{File: name, Line: 15, Err: UnknownKeyError("max_backof")},
+			{File: name, Line: 16, Err: InvalidTimeoutError(-5)},
+			{File: name, Line: 17, Err: InvalidTimeoutError(-2)},
+		}))
+	})
+
+	It("should report invalid circuit breakers of fallback plugins", func() {
+		check(`endpoints:
+- path: /
+  plugins:
+    - name: proxy
+  fallback:
+    - name: maintenance
+      circuit_breaker:
+        failure_rate: high
+        open_timeout: -1
+`)
+		Ω(checked.Problems).Should(Equal([]Problem{
+			{File: name, Line: 8, Err: &InvalidTypeError{Value: "high", Type: "number"}},
+			{File: name, Line: 9, Err: InvalidTimeoutError(-1)},
+		}))
+	})
+
+	It("should report unresolved references with their lines", func() {
+		check(`
+admin:
+  token: ${AKER_TEST_UNDEFINED}
+`)
+		Ω(checked.Problems).Should(Equal([]Problem{
+			{File: name, Line: 3, Err: UndefinedVariableError("AKER_TEST_UNDEFINED")},
+		}))
+	})
+
+	It("should report the lines of values in flow collections", func() {
+		check(`endpoints:
+  - {path: /,
+     audit: maybe}
+`)
+		Ω(checked.Problems).Should(Equal([]Problem{
+			{File: name, Line: 3, Err: &InvalidTypeError{Value: "maybe", Type: "boolean"}},
+		}))
+	})
+
+	It("should report syntax errors with their lines", func() {
+		check("server:\n  port: @8080\nendpoints: []\n")
+		Ω(checked.Problems).Should(HaveLen(1))
+		Ω(checked.Problems[0].Line).Should(Equal(2))
+	})
+
+	It("should report missing files", func() {
+		checked = Check(filepath.Join(dir, "missing.yml"))
+		Ω(checked.Problems).Should(HaveLen(1))
+		Ω(checked.Problems[0].Line).Should(Equal(0))
+	})
+
+	Describe("Report", func() {
+		BeforeEach(func() {
+			check(`endpoints:
+  - path: /
+    plugins:
+      - name: proxy
+        configuration: {url: "http://example.com"}
+`)
+		})
+
+		It("should add the problem at the line of the value", func() {
+			checked.Report(UnknownKeyError("x"), "endpoints", 0, "plugins", 0, "name")
+			Ω(checked.Problems).Should(Equal([]Problem{{File: name, Line: 4, Err: UnknownKeyError("x")}}))
+		})
+
+		It("should fall back to the line of the closest parent", func() {
+			checked.Report(UnknownKeyError("x"), "endpoints", 0, "plugins", 0, "configuration", "url")
+			Ω(checked.Problems).Should(Equal([]Problem{{File: name, Line: 5, Err: UnknownKeyError("x")}}))
+		})
+
+		It("should keep only the first problem of a value", func() {
+			checked.Report(UnknownKeyError("x"), "endpoints", 0)
+			checked.Report(UnknownKeyError("y"), "endpoints", 0)
+			Ω(checked.Problems).Should(Equal([]Problem{{File: name, Line: 2, Err: UnknownKeyError("x")}}))
+		})
+
+		It("should format problems with their location", func() {
+			checked.Report(UnknownKeyError("x"), "endpoints", 0)
+			Ω(checked.Problems[0].String()).Should(Equal(name + `:2: unknown key: "x"`))
+		})
+	})
+})
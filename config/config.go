@@ -2,56 +2,235 @@
 package config
 
 import (
-	"io"
 	"io/ioutil"
 	"os"
-
-	"gopkg.in/yaml.v2"
+	"reflect"
 )
 
 type Config struct {
-	Server    ServerConfig `yaml:"server"`
-	Endpoints []Endpoint   `yaml:"endpoints"`
+	Server ServerConfig `yaml:"server"`
+	// Admin enables the admin API, when specified.
+	Admin *AdminConfig `yaml:"admin"`
+	// Include lists files defining further endpoints. Each entry is a file,
+	// a glob pattern or a directory, whose *.yml and *.yaml files are
+	// included. Relative paths are resolved against the directory of the
+	// including file.
+	Include []string `yaml:"include"`
+	// Plugins defines plugins by name, which endpoints and chains can use.
+	Plugins map[string]PluginReference `yaml:"plugins"`
+	// Chains defines plugin chains by name, which endpoints can use instead
+	// of listing their plugins.
+	Chains    map[string][]PluginReference `yaml:"chains"`
+	Endpoints []Endpoint                   `yaml:"endpoints"`
 }
 
 type ServerConfig struct {
-	Host         string `yaml:"host"`
-	Port         int    `yaml:"port"`
-	ReadTimeout  int    `yaml:"read_timeout"`
-	WriteTimeout int    `yaml:"write_timeout"`
+	Host              string `yaml:"host"`
+	Port              int    `yaml:"port"`
+	ReadTimeout       int    `yaml:"read_timeout"`
+	WriteTimeout      int    `yaml:"write_timeout"`
+	ShutdownTimeout   int    `yaml:"shutdown_timeout"`
+	PluginStopTimeout int    `yaml:"plugin_stop_timeout"`
+	// TLS enables HTTPS on the front listener, when specified.
+	TLS       *TLSConfig      `yaml:"tls"`
+	RequestID RequestIDConfig `yaml:"request_id"`
+	// PluginPath lists directories that are searched for plugin
+	// executables before the ones in the PATH environment variable.
+	PluginPath []string `yaml:"plugin_path"`
+}
+
+type RequestIDConfig struct {
+	// Header defaults to "X-Aker-Request-Id".
+	Header string `yaml:"header"`
+	// Generator is one of "uuidv4" (the default), "uuidv7" or "ulid".
+	Generator string `yaml:"generator"`
+	// Format that incoming request IDs must have, one of "uuid", "ulid" or
+	// "any". It defaults to the format of the generator.
+	Format string `yaml:"format"`
+	// TrustedSources are IP addresses and CIDR ranges whose request IDs are
+	// kept.
+	TrustedSources []string `yaml:"trusted_sources"`
+}
+
+type TLSConfig struct {
+	// Certificates are selected based on the server name requested by the
+	// client (SNI). The first one is used when none of them matches.
+	Certificates []CertificateConfig `yaml:"certificates"`
+	MinVersion   string              `yaml:"min_version"`
+	CipherSuites []string            `yaml:"cipher_suites"`
+	// ClientCA enables mutual TLS. Client certificates are verified against
+	// the CA certificates in this PEM file.
+	ClientCA string `yaml:"client_ca"`
+	// ClientAuth is either "require" (the default) or "optional".
+	ClientAuth string `yaml:"client_auth"`
+}
+
+type AdminConfig struct {
+	// Address is the "host:port" to listen on over TCP.
+	Address string `yaml:"address"`
+	// SocketPath is the unix socket to listen on instead of Address.
+	SocketPath string `yaml:"socket_path"`
+	// Token is required from clients as a bearer token, when specified.
+	Token string `yaml:"token"`
+}
+
+type CertificateConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
 }
 
 type Endpoint struct {
-	Path    string            `yaml:"path"`
-	Audit   bool              `yaml:"audit"`
+	// Hosts restricts the endpoint to requests for these hosts. Wildcards
+	// like "*.example.com" are allowed.
+	Hosts []string `yaml:"hosts"`
+	// Path may contain parameters like "/users/{id}".
+	Path string `yaml:"path"`
+	// PathRegex matches the request path against a regular expression
+	// instead of Path. Its named groups become parameters.
+	PathRegex string `yaml:"path_regex"`
+	Match     Match  `yaml:"match"`
+	Audit     bool   `yaml:"audit"`
+	// Timeout is the time in seconds the plugin chain is given to start
+	// responding to a request. Zero means no limit.
+	Timeout int `yaml:"timeout"`
+	// ChainMode is either "forward" (the default), where each plugin
+	// forwards requests to the next plugin itself, or "hub", where each
+	// plugin returns them to Aker, which passes them on.
+	ChainMode string `yaml:"chain_mode"`
+	// BodyBuffer configures how Aker buffers the request body in hub mode.
+	BodyBuffer BodyBuffer `yaml:"body_buffer"`
+	// Chain is the name of a chain to use instead of Plugins.
+	Chain   string            `yaml:"chain"`
 	Plugins []PluginReference `yaml:"plugins"`
+	// Fallback is the chain serving the requests while the circuit of a
+	// plugin in Plugins is open.
+	Fallback []PluginReference `yaml:"fallback"`
+	// Source is the configuration file the endpoint is defined in.
+	Source string `yaml:"-"`
+}
+
+// Match narrows down the requests an endpoint serves beyond their path.
+type Match struct {
+	Methods []string `yaml:"methods"`
+	// Headers and Query map names to required values. A value of "*"
+	// requires only that the header or query parameter is present.
+	Headers map[string]string `yaml:"headers"`
+	Query   map[string]string `yaml:"query"`
 }
 
 type PluginReference struct {
-	Name   string       `yaml:"name"`
-	Config PluginConfig `yaml:"configuration"`
+	// Use is the name of a plugin definition. It cannot be combined with the
+	// other fields, which are copied from the definition.
+	Use           string        `yaml:"use"`
+	Name          string        `yaml:"name"`
+	Config        PluginConfig  `yaml:"configuration"`
+	RestartPolicy RestartPolicy `yaml:"restart_policy"`
+	// ReadyTimeout is the time in seconds the plugin is given to become
+	// ready when it is started.
+	ReadyTimeout int `yaml:"ready_timeout"`
+	// ResponseTimeout is the time in seconds the plugin is given to start
+	// responding to a request passed to it. Zero means no limit.
+	ResponseTimeout int            `yaml:"response_timeout"`
+	CircuitBreaker  CircuitBreaker `yaml:"circuit_breaker"`
+	BodyBuffer      BodyBuffer     `yaml:"body_buffer"`
+	// Replicas is the number of plugin processes to balance requests across.
+	Replicas int `yaml:"replicas"`
+	// LoadBalancing is either "round-robin" (the default) or
+	// "least-in-flight".
+	LoadBalancing string `yaml:"load_balancing"`
+	// Args are passed to the plugin executable on its command line.
+	Args []string `yaml:"args"`
+	// Env sets environment variables of the plugin processes, in addition
+	// to those of Aker unless CleanEnv is set.
+	Env      map[string]string `yaml:"env"`
+	CleanEnv bool              `yaml:"clean_env"`
+	// Dir is the working directory of the plugin processes. It defaults to
+	// the one of Aker.
+	Dir string `yaml:"dir"`
+}
+
+type RestartPolicy struct {
+	// Mode is one of "on-failure" (the default), "always" or "never".
+	Mode        string `yaml:"mode"`
+	MaxRestarts int    `yaml:"max_restarts"`
+	// Backoff and MaxBackoff are specified in seconds.
+	Backoff    int `yaml:"backoff"`
+	MaxBackoff int `yaml:"max_backoff"`
+}
+
+// CircuitBreaker stops passing requests to a failing plugin. It is disabled
+// unless one of the thresholds is set.
+type CircuitBreaker struct {
+	// ConsecutiveFailures and FailureRate are the thresholds opening the
+	// circuit. FailureRate is checked against the last Window requests.
+	ConsecutiveFailures int     `yaml:"consecutive_failures"`
+	FailureRate         float64 `yaml:"failure_rate"`
+	Window              int     `yaml:"window"`
+	// OpenTimeout is the time in seconds the circuit stays open before
+	// HalfOpenRequests probe requests are let through.
+	OpenTimeout      int `yaml:"open_timeout"`
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// BodyBuffer configures how a plugin buffers the request body, so that the
+// next plugin of the chain can read it as well.
+type BodyBuffer struct {
+	// MemoryLimit is the number of bytes kept in memory, the rest of the
+	// body is written to a temporary file in SpillDir. MaxSize limits the
+	// size of the body in bytes.
+	MemoryLimit int64  `yaml:"memory_limit"`
+	SpillDir    string `yaml:"spill_dir"`
+	MaxSize     int64  `yaml:"max_size"`
 }
 
 type PluginConfig map[string]interface{}
 
+// LoadFromFile loads the configuration file along with the files it
+// includes. The endpoints of the included files follow those of the
+// including file.
 func LoadFromFile(name string) (Config, error) {
-	file, err := os.Open(name)
+	config := Config{}
+	if err := decodeFile(name, &config); err != nil {
+		return Config{}, err
+	}
+	setSource(config.Endpoints, name)
+
+	included, err := loadIncludes(name, config.Include, map[string]bool{absolute(name): true})
 	if err != nil {
 		return Config{}, err
 	}
-	defer file.Close()
+	config.Endpoints = append(config.Endpoints, included...)
 
-	return loadFromReader(file)
+	var firstErr error
+	resolveDefinitions(&config, func(err error, path ...interface{}) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	})
+	if firstErr != nil {
+		return Config{}, firstErr
+	}
+	return config, nil
 }
 
-func loadFromReader(reader io.Reader) (Config, error) {
-	content, err := ioutil.ReadAll(reader)
+func decodeFile(name string, out interface{}) error {
+	content, err := ioutil.ReadFile(name)
 	if err != nil {
-		return Config{}, err
+		return err
 	}
-	config := Config{}
-	if err := yaml.Unmarshal(content, &config); err != nil {
-		return Config{}, err
+	return decode(content, out)
+}
+
+// decode resolves the references in the content and decodes it into the
+// value pointed to by out.
+func decode(content []byte, out interface{}) error {
+	root, err := parse(content)
+	if err != nil || root == nil {
+		return err
 	}
-	return config, nil
+	r := &resolver{lookup: os.LookupEnv}
+	if err := r.resolve(root, reflect.TypeOf(out).Elem()); err != nil {
+		return err
+	}
+	return root.Decode(out)
 }
@@ -27,6 +27,28 @@ var _ = Describe("Config", func() {
 				Ω(config.Server.Port).Should(Equal(8080))
 				Ω(config.Server.ReadTimeout).Should(Equal(5))
 				Ω(config.Server.WriteTimeout).Should(Equal(10))
+				Ω(config.Server.ShutdownTimeout).Should(Equal(30))
+				Ω(config.Server.PluginStopTimeout).Should(Equal(3))
+			})
+
+			It("should have proper server TLS section", func() {
+				Ω(config.Server.TLS).Should(Equal(&TLSConfig{
+					Certificates: []CertificateConfig{
+						{CertFile: "/etc/aker/a.crt", KeyFile: "/etc/aker/a.key"},
+						{CertFile: "/etc/aker/b.crt", KeyFile: "/etc/aker/b.key"},
+					},
+					MinVersion:   "1.2",
+					CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+					ClientCA:     "/etc/aker/ca.crt",
+					ClientAuth:   "optional",
+				}))
+			})
+
+			It("should have proper admin section", func() {
+				Ω(config.Admin).Should(Equal(&AdminConfig{
+					SocketPath: "/var/run/aker/admin.sock",
+					Token:      "s3cr3t",
+				}))
 			})
 
 			It("should have proper endpoint section", func() {
@@ -35,9 +57,16 @@ var _ = Describe("Config", func() {
 					Path:    "/",
 					Audit:   false,
 					Plugins: []PluginReference{},
+					Source:  "valid_config.yml",
 				}))
 				Ω(config.Endpoints[1]).Should(Equal(Endpoint{
+					Hosts: []string{"example.com", "*.example.com"},
 					Path:  "/proxy",
+					Match: Match{
+						Methods: []string{"GET", "POST"},
+						Headers: map[string]string{"X-Debug": "*"},
+						Query:   map[string]string{"format": "json"},
+					},
 					Audit: true,
 					Plugins: []PluginReference{
 						PluginReference{
@@ -45,7 +74,14 @@ var _ = Describe("Config", func() {
 							Config: map[string]interface{}{
 								"url": "http://location.com",
 							},
+							RestartPolicy: RestartPolicy{
+								Mode:        "always",
+								MaxRestarts: 5,
+								Backoff:     2,
+								MaxBackoff:  30,
+							},
 						}},
+					Source: "valid_config.yml",
 				}))
 			})
 		})
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+)
+
+// resolveDefinitions replaces the references of the endpoints to chains and
+// plugin definitions with the plugins they refer to. Each problem is
+// reported along with the path of the value causing it.
+func resolveDefinitions(config *Config, report func(err error, path ...interface{})) {
+	for _, name := range sortedNames(config.Plugins) {
+		if use := config.Plugins[name].Use; use != "" {
+			report(AmbiguousPluginError(use), "plugins", name, "use")
+		}
+	}
+
+	chains := make(map[string][]PluginReference, len(config.Chains))
+	for _, name := range sortedNames(config.Chains) {
+		chains[name] = resolvePlugins(config.Plugins, config.Chains[name], func(err error, path ...interface{}) {
+			report(err, append([]interface{}{"chains", name}, path...)...)
+		})
+	}
+
+	for index := range config.Endpoints {
+		endpoint := &config.Endpoints[index]
+		endpointReport := func(err error, path ...interface{}) {
+			report(err, append([]interface{}{"endpoints", index}, path...)...)
+		}
+		endpoint.Fallback = resolvePlugins(config.Plugins, endpoint.Fallback, func(err error, path ...interface{}) {
+			endpointReport(err, append([]interface{}{"fallback"}, path...)...)
+		})
+		if endpoint.Chain == "" {
+			endpoint.Plugins = resolvePlugins(config.Plugins, endpoint.Plugins, func(err error, path ...interface{}) {
+				endpointReport(err, append([]interface{}{"plugins"}, path...)...)
+			})
+			continue
+		}
+
+		chain, ok := chains[endpoint.Chain]
+		switch {
+		case !ok:
+			endpointReport(UnknownChainError(endpoint.Chain), "chain")
+		case len(endpoint.Plugins) > 0:
+			endpointReport(AmbiguousChainError(endpoint.Chain), "plugins")
+		default:
+			endpoint.Plugins = chain
+		}
+	}
+}
+
+// resolvePlugins returns a copy of the references with the plugin
+// definitions they use filled in.
+func resolvePlugins(definitions map[string]PluginReference, references []PluginReference, report func(err error, path ...interface{})) []PluginReference {
+	if references == nil {
+		return nil
+	}
+	resolved := make([]PluginReference, len(references))
+	for index, reference := range references {
+		resolved[index] = reference
+		if reference.Use == "" {
+			continue
+		}
+		if !reflect.DeepEqual(reference, PluginReference{Use: reference.Use}) {
+			report(AmbiguousPluginError(reference.Use), index)
+			continue
+		}
+		definition, ok := definitions[reference.Use]
+		if !ok {
+			report(UnknownPluginError(reference.Use), index, "use")
+			continue
+		}
+		definition.Use = reference.Use
+		resolved[index] = definition
+	}
+	return resolved
+}
+
+// sortedNames returns the keys of a map with string keys in order.
+func sortedNames(definitions interface{}) []string {
+	keys := reflect.ValueOf(definitions).MapKeys()
+	names := make([]string, len(keys))
+	for index, key := range keys {
+		names[index] = key.String()
+	}
+	sort.Strings(names)
+	return names
+}
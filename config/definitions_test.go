@@ -0,0 +1,143 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/SAP/aker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Definitions", func() {
+	var dir string
+	var name string
+
+	write := func(content string) {
+		Ω(ioutil.WriteFile(name, []byte(content), 0600)).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "aker-config")
+		Ω(err).ShouldNot(HaveOccurred())
+		name = filepath.Join(dir, "config.yml")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should resolve used plugins and chains", func() {
+		write(`
+plugins:
+  auth:
+    name: aker-auth
+    configuration:
+      realm: aker
+    replicas: 2
+chains:
+  api:
+    - use: auth
+    - name: aker-proxy
+endpoints:
+  - path: /api/
+    chain: api
+  - path: /admin/
+    plugins:
+      - use: auth
+      - name: aker-admin
+    fallback:
+      - use: auth
+      - name: aker-maintenance
+`)
+		config, err := LoadFromFile(name)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		auth := PluginReference{
+			Use:      "auth",
+			Name:     "aker-auth",
+			Config:   PluginConfig{"realm": "aker"},
+			Replicas: 2,
+		}
+		Ω(config.Endpoints[0].Plugins).Should(Equal([]PluginReference{auth, {Name: "aker-proxy"}}))
+		Ω(config.Endpoints[1].Plugins).Should(Equal([]PluginReference{auth, {Name: "aker-admin"}}))
+		Ω(config.Endpoints[1].Fallback).Should(Equal([]PluginReference{auth, {Name: "aker-maintenance"}}))
+	})
+
+	It("should fail on unknown plugin definitions", func() {
+		write(`
+endpoints:
+  - path: /
+    plugins:
+      - use: auth
+`)
+		_, err := LoadFromFile(name)
+		Ω(err).Should(Equal(UnknownPluginError("auth")))
+	})
+
+	It("should fail on unknown chains", func() {
+		write(`
+endpoints:
+  - path: /
+    chain: api
+`)
+		_, err := LoadFromFile(name)
+		Ω(err).Should(Equal(UnknownChainError("api")))
+	})
+
+	It("should fail on references that use a definition and set other fields", func() {
+		write(`
+plugins:
+  auth:
+    name: aker-auth
+endpoints:
+  - path: /
+    plugins:
+      - use: auth
+        replicas: 3
+`)
+		_, err := LoadFromFile(name)
+		Ω(err).Should(Equal(AmbiguousPluginError("auth")))
+	})
+
+	It("should fail on endpoints that use a chain and list plugins", func() {
+		write(`
+chains:
+  api:
+    - name: aker-proxy
+endpoints:
+  - path: /
+    chain: api
+    plugins:
+      - name: aker-proxy
+`)
+		_, err := LoadFromFile(name)
+		Ω(err).Should(Equal(AmbiguousChainError("api")))
+	})
+
+	It("should report the problems of all references when checked", func() {
+		write(`plugins:
+  auth:
+    name: aker-auth
+chains:
+  api:
+    - use: missing
+endpoints:
+  - path: /
+    chain: other
+  - path: /admin/
+    plugins:
+      - use: auth
+        replicas: 3
+`)
+		checked := Check(name)
+		Ω(checked.Problems).Should(Equal([]Problem{
+			{File: name, Line: 6, Err: UnknownPluginError("missing")},
+			{File: name, Line: 9, Err: UnknownChainError("other")},
+			{File: name, Line: 12, Err: AmbiguousPluginError("auth")},
+		}))
+	})
+})
@@ -0,0 +1,91 @@
+package config
+
+import "fmt"
+
+type UndefinedVariableError string
+
+func (e UndefinedVariableError) Error() string {
+	return fmt.Sprintf("undefined environment variable: %q", string(e))
+}
+
+type InvalidReferenceError string
+
+func (e InvalidReferenceError) Error() string {
+	return fmt.Sprintf("invalid reference: %q", string(e))
+}
+
+type SecretFileError struct {
+	Path string
+	Err  error
+}
+
+func (e *SecretFileError) Error() string {
+	return fmt.Sprintf("failed to read secret file %q: %v", e.Path, e.Err)
+}
+
+type UnknownKeyError string
+
+func (e UnknownKeyError) Error() string {
+	return fmt.Sprintf("unknown key: %q", string(e))
+}
+
+// InvalidTypeError is returned when a value cannot be decoded into the type
+// of its field.
+type InvalidTypeError struct {
+	Value interface{}
+	Type  string
+}
+
+func (e *InvalidTypeError) Error() string {
+	return fmt.Sprintf("cannot use %#v as %s", e.Value, e.Type)
+}
+
+type InvalidTimeoutError int
+
+func (e InvalidTimeoutError) Error() string {
+	return fmt.Sprintf("invalid timeout: %d, must not be negative", int(e))
+}
+
+type IncludeCycleError string
+
+func (e IncludeCycleError) Error() string {
+	return fmt.Sprintf("file includes itself: %q", string(e))
+}
+
+// IncludeError is returned when an included file cannot be loaded.
+type IncludeError struct {
+	File string
+	Err  error
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("included file %q: %v", e.File, e.Err)
+}
+
+type UnknownPluginError string
+
+func (e UnknownPluginError) Error() string {
+	return fmt.Sprintf("unknown plugin definition: %q", string(e))
+}
+
+type UnknownChainError string
+
+func (e UnknownChainError) Error() string {
+	return fmt.Sprintf("unknown chain: %q", string(e))
+}
+
+// AmbiguousPluginError is returned for plugin references that use a
+// definition and set other fields as well.
+type AmbiguousPluginError string
+
+func (e AmbiguousPluginError) Error() string {
+	return fmt.Sprintf("plugin reference using %q must not set other fields", string(e))
+}
+
+// AmbiguousChainError is returned for endpoints that use a chain and list
+// plugins as well.
+type AmbiguousChainError string
+
+func (e AmbiguousChainError) Error() string {
+	return fmt.Sprintf("endpoint using chain %q must not list plugins", string(e))
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fragment is the content of an included file.
+type fragment struct {
+	Include   []string   `yaml:"include"`
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
+
+// loadIncludes loads the endpoints of the files included by the named file.
+// visiting holds the absolute paths of the files being loaded, which must
+// not be included again.
+func loadIncludes(name string, patterns []string, visiting map[string]bool) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, pattern := range patterns {
+		files, err := expandInclude(filepath.Dir(name), pattern)
+		if err != nil {
+			return nil, &IncludeError{File: pattern, Err: err}
+		}
+		for _, file := range files {
+			included, err := loadFragment(file, visiting)
+			if err != nil {
+				return nil, &IncludeError{File: file, Err: err}
+			}
+			endpoints = append(endpoints, included...)
+		}
+	}
+	return endpoints, nil
+}
+
+func loadFragment(name string, visiting map[string]bool) ([]Endpoint, error) {
+	key := absolute(name)
+	if visiting[key] {
+		return nil, IncludeCycleError(name)
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFragmentKeys(content); err != nil {
+		return nil, err
+	}
+	f := fragment{}
+	if err := decode(content, &f); err != nil {
+		return nil, err
+	}
+	setSource(f.Endpoints, name)
+
+	included, err := loadIncludes(name, f.Include, visiting)
+	if err != nil {
+		return nil, err
+	}
+	return append(f.Endpoints, included...), nil
+}
+
+// checkFragmentKeys makes sure that an included file does not try to
+// change other sections than the endpoints, which would go unnoticed
+// otherwise.
+func checkFragmentKeys(content []byte) error {
+	var top map[string]interface{}
+	if err := yaml.Unmarshal(content, &top); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(top))
+	for key := range top {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fieldType(reflect.TypeOf(fragment{}), key) == nil {
+			return UnknownKeyError(key)
+		}
+	}
+	return nil
+}
+
+// expandInclude returns the files an include entry refers to, in lexical
+// order.
+func expandInclude(dir, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	if strings.ContainsAny(pattern, `*?[\`) {
+		return filepath.Glob(pattern)
+	}
+
+	info, err := os.Stat(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{pattern}, nil
+	}
+	var files []string
+	for _, extension := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(pattern, extension))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func setSource(endpoints []Endpoint, name string) {
+	for index := range endpoints {
+		endpoints[index].Source = name
+	}
+}
+
+func absolute(name string) string {
+	if path, err := filepath.Abs(name); err == nil {
+		return path
+	}
+	return name
+}
@@ -0,0 +1,129 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/SAP/aker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Include", func() {
+	var dir string
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Ω(os.MkdirAll(filepath.Dir(path), 0700)).Should(Succeed())
+		Ω(ioutil.WriteFile(path, []byte(content), 0600)).Should(Succeed())
+		return path
+	}
+
+	paths := func(endpoints []Endpoint) []string {
+		result := make([]string, len(endpoints))
+		for index, endpoint := range endpoints {
+			result[index] = endpoint.Path + " " + endpoint.Source
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "aker-config")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should append the endpoints of included files and directories", func() {
+		main := write("config.yml", `
+include:
+  - conf.d
+  - teams/*.yml
+endpoints:
+  - path: /
+`)
+		write("conf.d/b.yaml", "endpoints: [{path: /b}]\n")
+		write("conf.d/a.yml", "endpoints: [{path: /a}]\ninclude: [../nested/c.yml]\n")
+		write("conf.d/ignored.txt", "endpoints: [{path: /ignored}]\n")
+		write("nested/c.yml", "endpoints: [{path: /c}]\n")
+		write("teams/d.yml", "endpoints: [{path: /d}]\n")
+
+		config, err := LoadFromFile(main)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(paths(config.Endpoints)).Should(Equal([]string{
+			"/ " + main,
+			"/a " + filepath.Join(dir, "conf.d/a.yml"),
+			"/c " + filepath.Join(dir, "nested/c.yml"),
+			"/b " + filepath.Join(dir, "conf.d/b.yaml"),
+			"/d " + filepath.Join(dir, "teams/d.yml"),
+		}))
+	})
+
+	It("should allow globs without matches", func() {
+		main := write("config.yml", "include: [conf.d/*.yml]\nendpoints: [{path: /}]\n")
+		config, err := LoadFromFile(main)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Endpoints).Should(HaveLen(1))
+	})
+
+	It("should fail when an included file is missing", func() {
+		main := write("config.yml", "include: [missing.yml]\n")
+		_, err := LoadFromFile(main)
+		Ω(err).Should(BeAssignableToTypeOf(&IncludeError{}))
+		Ω(err.(*IncludeError).File).Should(Equal("missing.yml"))
+	})
+
+	It("should fail when files include each other", func() {
+		main := write("config.yml", "include: [a.yml]\n")
+		write("a.yml", "include: [config.yml]\n")
+		_, err := LoadFromFile(main)
+		Ω(err).Should(Equal(&IncludeError{
+			File: filepath.Join(dir, "a.yml"),
+			Err:  &IncludeError{File: main, Err: IncludeCycleError(main)},
+		}))
+	})
+
+	It("should fail when an included file defines other sections", func() {
+		main := write("config.yml", "include: [a.yml]\n")
+		write("a.yml", "server:\n  port: 9090\n")
+		_, err := LoadFromFile(main)
+		Ω(err).Should(Equal(&IncludeError{File: filepath.Join(dir, "a.yml"), Err: UnknownKeyError("server")}))
+	})
+
+	Describe("Check", func() {
+		It("should report problems in the files defining them", func() {
+			main := write("config.yml", `include:
+  - a.yml
+  - missing.yml
+endpoints:
+  - path: /
+`)
+			included := write("a.yml", `server:
+  port: 9090
+endpoints:
+  - path: /a
+    audit: maybe
+  - path: /b
+`)
+			checked := Check(main)
+			Ω(checked.Config.Endpoints).Should(HaveLen(3))
+
+			checked.Report(UnknownKeyError("x"), "endpoints", 2, "path")
+			checked.Report(UnknownKeyError("y"), "endpoints", 0)
+			Ω(checked.Problems).Should(HaveLen(5))
+			Ω(checked.Problems[0].File).Should(Equal(main))
+			Ω(checked.Problems[0].Line).Should(Equal(3))
+			Ω(checked.Problems[1:]).Should(Equal([]Problem{
+				{File: main, Line: 5, Err: UnknownKeyError("y")},
+				{File: included, Line: 1, Err: UnknownKeyError("server")},
+				{File: included, Line: 5, Err: &InvalidTypeError{Value: "maybe", Type: "boolean"}},
+				{File: included, Line: 6, Err: UnknownKeyError("x")},
+			}))
+		})
+	})
+})
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileTag marks a value as the path of a file to read the value from.
+const fileTag = "!file"
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parse parses the configuration text into the node tree of its document,
+// which keeps the tags and the lines of the values. It returns nil for an
+// empty document.
+func parse(content []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return document.Content[0], nil
+}
+
+// resolver resolves the environment variable and secret file references in
+// the string values of the configuration, e.g.
+//
+//	token: ${UPSTREAM_TOKEN}
+//	timeout: ${TIMEOUT:-30}
+//	password: !file /run/secrets/password
+//
+// The values are resolved in the parsed node tree, so they cannot change its
+// structure. A value resolved for a number or boolean field is decoded as
+// such.
+type resolver struct {
+	lookup func(string) (string, bool)
+	// report is called with the path of each value that cannot be resolved,
+	// which is then left as it is. When report is nil, resolving stops at
+	// the first such value.
+	report func(path []interface{}, err error)
+	path   []interface{}
+}
+
+// resolve walks the node tree alongside the type it is going to be decoded
+// into. The type is nil where it is not known, e.g. in plugin
+// configurations. Aliases are resolved where their anchors are.
+func (r *resolver) resolve(node *yaml.Node, target reflect.Type) error {
+	for target != nil && target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key := node.Content[index].Value
+			if err := r.resolveElement(node.Content[index+1], fieldType(target, key), key); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		var elem reflect.Type
+		if target != nil && (target.Kind() == reflect.Slice || target.Kind() == reflect.Array) {
+			elem = target.Elem()
+		}
+		for index, item := range node.Content {
+			if err := r.resolveElement(item, elem, index); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		err := r.resolveScalar(node, target)
+		if err != nil && r.report != nil {
+			r.report(r.path, err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *resolver) resolveElement(node *yaml.Node, target reflect.Type, element interface{}) error {
+	r.path = appendPath(r.path, element)
+	defer func() { r.path = r.path[:len(r.path)-1] }()
+	return r.resolve(node, target)
+}
+
+func (r *resolver) resolveScalar(node *yaml.Node, target reflect.Type) error {
+	file := node.Tag == fileTag
+	if !file && node.ShortTag() != "!!str" {
+		return nil
+	}
+	resolved, err := r.expand(node.Value)
+	if err != nil {
+		return err
+	}
+	if file {
+		content, err := ioutil.ReadFile(resolved)
+		if err != nil {
+			return &SecretFileError{Path: resolved, Err: err}
+		}
+		// files usually end with a line break, secrets hardly ever do
+		resolved = strings.TrimRight(string(content), "\r\n")
+	} else if resolved == node.Value {
+		return nil
+	}
+
+	node.Value = resolved
+	if target == nil || target.Kind() == reflect.String || target.Kind() == reflect.Interface {
+		node.Tag, node.Style = "!!str", 0
+		return nil
+	}
+	// let the decoder resolve the type of the value as if it was written
+	// without quotes
+	node.Tag, node.Style = "", 0
+	return nil
+}
+
+// expand replaces the ${NAME} and ${NAME:-default} references with the values
+// of the environment variables. The default is used when the variable is
+// unset or empty. "$$" stands for a literal "$".
+func (r *resolver) expand(value string) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var result strings.Builder
+	for index := 0; index < len(value); index++ {
+		if value[index] != '$' || index+1 == len(value) {
+			result.WriteByte(value[index])
+			continue
+		}
+		switch value[index+1] {
+		case '$':
+			result.WriteByte('$')
+			index++
+		case '{':
+			end := strings.IndexByte(value[index:], '}')
+			if end < 0 {
+				return "", InvalidReferenceError(value[index:])
+			}
+			resolved, err := r.variable(value[index : index+end+1])
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(resolved)
+			index += end
+		default:
+			result.WriteByte('$')
+		}
+	}
+	return result.String(), nil
+}
+
+// variable resolves a single reference like "${NAME:-default}".
+func (r *resolver) variable(reference string) (string, error) {
+	name := reference[2 : len(reference)-1]
+	fallback, hasFallback := "", false
+	if separator := strings.Index(name, ":-"); separator >= 0 {
+		name, fallback, hasFallback = name[:separator], name[separator+2:], true
+	}
+	if !variableName.MatchString(name) {
+		return "", InvalidReferenceError(reference)
+	}
+
+	value, ok := r.lookup(name)
+	switch {
+	case hasFallback && value == "":
+		return fallback, nil
+	case !ok:
+		return "", UndefinedVariableError(name)
+	default:
+		return value, nil
+	}
+}
+
+// fieldType returns the type of the struct field or map value the key is
+// decoded into, following the naming rules of the YAML decoder.
+func fieldType(target reflect.Type, key interface{}) reflect.Type {
+	if target == nil {
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Map:
+		return target.Elem()
+	case reflect.Struct:
+		name, ok := key.(string)
+		if !ok {
+			return nil
+		}
+		for index := 0; index < target.NumField(); index++ {
+			field := target.Field(index)
+			fieldName := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if fieldName == "" {
+				fieldName = strings.ToLower(field.Name)
+			}
+			if fieldName == name {
+				return field.Type
+			}
+		}
+	}
+	return nil
+}
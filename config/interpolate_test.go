@@ -0,0 +1,179 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/SAP/aker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Interpolation", func() {
+	var dir string
+	var config Config
+	var err error
+
+	load := func(content string) {
+		name := filepath.Join(dir, "config.yml")
+		Ω(ioutil.WriteFile(name, []byte(content), 0600)).Should(Succeed())
+		config, err = LoadFromFile(name)
+	}
+
+	BeforeEach(func() {
+		dir, err = ioutil.TempDir("", "aker-config")
+		Ω(err).ShouldNot(HaveOccurred())
+		os.Setenv("AKER_TEST_TOKEN", "t0k3n")
+		os.Setenv("AKER_TEST_PORT", "9090")
+		os.Setenv("AKER_TEST_EMPTY", "")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("AKER_TEST_TOKEN")
+		os.Unsetenv("AKER_TEST_PORT")
+		os.Unsetenv("AKER_TEST_EMPTY")
+		os.RemoveAll(dir)
+	})
+
+	It("should resolve environment variables", func() {
+		load(`
+server:
+  host: ${AKER_TEST_HOST:-example.com}
+  port: ${AKER_TEST_PORT}
+admin:
+  token: "Bearer-${AKER_TEST_TOKEN}"
+endpoints:
+  - path: /
+    plugins:
+      - name: auth
+        configuration:
+          token: ${AKER_TEST_TOKEN}
+          port: ${AKER_TEST_PORT}
+          fallback: ${AKER_TEST_EMPTY:-none}
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Server.Host).Should(Equal("example.com"))
+		Ω(config.Server.Port).Should(Equal(9090))
+		Ω(config.Admin.Token).Should(Equal("Bearer-t0k3n"))
+		Ω(config.Endpoints[0].Plugins[0].Config).Should(Equal(PluginConfig{
+			"token":    "t0k3n",
+			"port":     "9090",
+			"fallback": "none",
+		}))
+	})
+
+	It("should keep escaped dollar signs", func() {
+		load(`
+admin:
+  token: $${AKER_TEST_TOKEN}$
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Admin.Token).Should(Equal("${AKER_TEST_TOKEN}$"))
+	})
+
+	It("should fail on undefined variables", func() {
+		load(`
+admin:
+  token: ${AKER_TEST_UNDEFINED}
+`)
+		Ω(err).Should(Equal(UndefinedVariableError("AKER_TEST_UNDEFINED")))
+	})
+
+	It("should fail on invalid references", func() {
+		load(`
+admin:
+  token: ${AKER TEST}
+`)
+		Ω(err).Should(Equal(InvalidReferenceError("${AKER TEST}")))
+	})
+
+	It("should fail on unterminated references", func() {
+		load(`
+admin:
+  token: ${AKER_TEST_TOKEN
+`)
+		Ω(err).Should(Equal(InvalidReferenceError("${AKER_TEST_TOKEN")))
+	})
+
+	Context("when secret files are referenced", func() {
+		BeforeEach(func() {
+			Ω(ioutil.WriteFile(filepath.Join(dir, "token"), []byte("s3cr3t\n"), 0600)).Should(Succeed())
+			Ω(ioutil.WriteFile(filepath.Join(dir, "port"), []byte("9191"), 0600)).Should(Succeed())
+			os.Setenv("AKER_TEST_DIR", dir)
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("AKER_TEST_DIR")
+		})
+
+		It("should read the values from the files", func() {
+			load(`
+server:
+  port: !file ${AKER_TEST_DIR}/port # the port
+admin:
+  token: !file "${AKER_TEST_DIR}/token"
+endpoints:
+  - path: /
+    plugins:
+      - name: auth
+        configuration:
+          passwords:
+            - !file '${AKER_TEST_DIR}/token'
+          note: "the !file tag"
+`)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Server.Port).Should(Equal(9191))
+			Ω(config.Admin.Token).Should(Equal("s3cr3t"))
+			Ω(config.Endpoints[0].Plugins[0].Config).Should(Equal(PluginConfig{
+				"passwords": []interface{}{"s3cr3t"},
+				"note":      "the !file tag",
+			}))
+		})
+
+		It("should read the values in flow collections and block scalars", func() {
+			load(`
+server: {port: !file "${AKER_TEST_DIR}/port"}
+endpoints:
+  - path: /
+    plugins:
+      - name: auth
+        configuration:
+          passwords: [!file "${AKER_TEST_DIR}/token", plain]
+          token: !file >-
+            ${AKER_TEST_DIR}/token
+          note: |
+            password: !file /etc/passwd
+`)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Server.Port).Should(Equal(9191))
+			Ω(config.Endpoints[0].Plugins[0].Config).Should(Equal(PluginConfig{
+				"passwords": []interface{}{"s3cr3t", "plain"},
+				"token":     "s3cr3t",
+				"note":      "password: !file /etc/passwd\n",
+			}))
+		})
+
+		It("should keep the lines of the values in decoding errors", func() {
+			load(`
+admin:
+  token: !file ${AKER_TEST_DIR}/token
+
+
+server:
+  port: !file ${AKER_TEST_DIR}/token
+`)
+			Ω(err).Should(MatchError(ContainSubstring("line 7:")))
+		})
+
+		It("should fail when a file cannot be read", func() {
+			load(`
+admin:
+  token: !file ${AKER_TEST_DIR}/missing
+`)
+			Ω(err).Should(BeAssignableToTypeOf(&SecretFileError{}))
+			Ω(err.(*SecretFileError).Path).Should(Equal(filepath.Join(dir, "missing")))
+		})
+	})
+})
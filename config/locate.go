@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// positions maps the paths of the values in a YAML document to the lines
+// they start at. Mapping values are located at the lines of their keys.
+type positions map[string]int
+
+func locate(root *yaml.Node) positions {
+	found := positions{}
+	found.walk(root, nil, root.Line)
+	return found
+}
+
+func (p positions) walk(node *yaml.Node, path []interface{}, line int) {
+	p.add(path, line)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key := node.Content[index]
+			p.walk(node.Content[index+1], appendPath(path, key.Value), key.Line)
+		}
+	case yaml.SequenceNode:
+		for index, item := range node.Content {
+			p.walk(item, appendPath(path, index), item.Line)
+		}
+	}
+}
+
+func appendPath(path []interface{}, element interface{}) []interface{} {
+	return append(path[:len(path):len(path)], element)
+}
+
+func (p positions) add(path []interface{}, line int) {
+	key := pathString(path)
+	if _, ok := p[key]; !ok {
+		p[key] = line
+	}
+}
+
+// line returns the line of the value at the path, or of its closest parent
+// that has been located.
+func (p positions) line(path []interface{}) int {
+	for length := len(path); length >= 0; length-- {
+		if line, ok := p[pathString(path[:length])]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// pathString formats a path like "endpoints[1].plugins[0].name".
+func pathString(path []interface{}) string {
+	var result strings.Builder
+	for _, element := range path {
+		if index, ok := element.(int); ok {
+			fmt.Fprintf(&result, "[%d]", index)
+			continue
+		}
+		if result.Len() > 0 {
+			result.WriteByte('.')
+		}
+		fmt.Fprint(&result, element)
+	}
+	return result.String()
+}
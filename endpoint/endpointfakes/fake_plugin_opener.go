@@ -9,12 +9,13 @@ import (
 )
 
 type FakePluginOpener struct {
-	OpenStub        func(name string, config []byte, next *plugin.Plugin) (*plugin.Plugin, error)
+	OpenStub        func(name string, config []byte, next *plugin.Plugin, options plugin.Options) (*plugin.Plugin, error)
 	openMutex       sync.RWMutex
 	openArgsForCall []struct {
-		name   string
-		config []byte
-		next   *plugin.Plugin
+		name    string
+		config  []byte
+		next    *plugin.Plugin
+		options plugin.Options
 	}
 	openReturns struct {
 		result1 *plugin.Plugin
@@ -24,7 +25,7 @@ type FakePluginOpener struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakePluginOpener) Open(name string, config []byte, next *plugin.Plugin) (*plugin.Plugin, error) {
+func (fake *FakePluginOpener) Open(name string, config []byte, next *plugin.Plugin, options plugin.Options) (*plugin.Plugin, error) {
 	var configCopy []byte
 	if config != nil {
 		configCopy = make([]byte, len(config))
@@ -32,14 +33,15 @@ func (fake *FakePluginOpener) Open(name string, config []byte, next *plugin.Plug
 	}
 	fake.openMutex.Lock()
 	fake.openArgsForCall = append(fake.openArgsForCall, struct {
-		name   string
-		config []byte
-		next   *plugin.Plugin
-	}{name, configCopy, next})
-	fake.recordInvocation("Open", []interface{}{name, configCopy, next})
+		name    string
+		config  []byte
+		next    *plugin.Plugin
+		options plugin.Options
+	}{name, configCopy, next, options})
+	fake.recordInvocation("Open", []interface{}{name, configCopy, next, options})
 	fake.openMutex.Unlock()
 	if fake.OpenStub != nil {
-		return fake.OpenStub(name, config, next)
+		return fake.OpenStub(name, config, next, options)
 	} else {
 		return fake.openReturns.result1, fake.openReturns.result2
 	}
@@ -51,10 +53,10 @@ func (fake *FakePluginOpener) OpenCallCount() int {
 	return len(fake.openArgsForCall)
 }
 
-func (fake *FakePluginOpener) OpenArgsForCall(i int) (string, []byte, *plugin.Plugin) {
+func (fake *FakePluginOpener) OpenArgsForCall(i int) (string, []byte, *plugin.Plugin, plugin.Options) {
 	fake.openMutex.RLock()
 	defer fake.openMutex.RUnlock()
-	return fake.openArgsForCall[i].name, fake.openArgsForCall[i].config, fake.openArgsForCall[i].next
+	return fake.openArgsForCall[i].name, fake.openArgsForCall[i].config, fake.openArgsForCall[i].next, fake.openArgsForCall[i].options
 }
 
 func (fake *FakePluginOpener) OpenReturns(result1 *plugin.Plugin, result2 error) {
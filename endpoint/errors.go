@@ -12,3 +12,34 @@ func (e InvalidPathError) Error() string {
 }
 
 var NoPluginsErr = errors.New("no plugins specified")
+
+type InvalidChainModeError string
+
+func (e InvalidChainModeError) Error() string {
+	return fmt.Sprintf("invalid chain mode: %q", string(e))
+}
+
+type InvalidPluginPositionError int
+
+func (e InvalidPluginPositionError) Error() string {
+	return fmt.Sprintf("no plugin at position %d of the chain", int(e))
+}
+
+// ChainError is returned when a plugin of an endpoint's chain cannot be
+// started. Position is the zero-based index of the plugin in the chain, or
+// in the fallback chain if Fallback is set.
+type ChainError struct {
+	Endpoint string
+	Fallback bool
+	Position int
+	Plugin   string
+	Err      error
+}
+
+func (e *ChainError) Error() string {
+	kind := "plugin"
+	if e.Fallback {
+		kind = "fallback plugin"
+	}
+	return fmt.Sprintf("endpoint %q: %s %q at position %d: %v", e.Endpoint, kind, e.Plugin, e.Position, e.Err)
+}
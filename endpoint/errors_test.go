@@ -14,4 +14,11 @@ var _ = Describe("Errors", func() {
 			Ω(err.Error()).Should(Equal(`invalid endpoint path: "path"`))
 		})
 	})
+
+	Describe("InvalidPluginPositionError", func() {
+		It("should return proper error message", func() {
+			err := InvalidPluginPositionError(3)
+			Ω(err.Error()).Should(Equal("no plugin at position 3 of the chain"))
+		})
+	})
 })
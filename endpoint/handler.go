@@ -1,12 +1,17 @@
 package endpoint
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/SAP/aker/config"
 	"github.com/SAP/aker/logging"
 	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/requestid"
 	"github.com/SAP/gologger"
 )
 
@@ -15,65 +20,396 @@ import (
 // Opener wraps the basic Open plugin method.
 type PluginOpener interface {
 	// Open should connect to and configure the specified plugin.
-	Open(name string, config []byte, next *plugin.Plugin) (*plugin.Plugin, error)
+	Open(name string, config []byte, next *plugin.Plugin, options plugin.Options) (*plugin.Plugin, error)
 }
 
 // Handler represents Aker endpoint.
 type Handler struct {
 	path        string
-	plugin      PluginOpener
+	config      config.Endpoint
+	plugins     []*plugin.Plugin
 	pluginChain http.Handler
+	// fallback serves the requests while the circuit of a plugin is open.
+	// It is empty unless configured.
+	fallback      []*plugin.Plugin
+	fallbackChain http.Handler
+	// serve is where requests enter the endpoint once accepted.
+	serve http.Handler
+	// timeout is the time the chain is given to start responding.
+	timeout time.Duration
+
+	mutex    sync.Mutex
+	idle     *sync.Cond
+	inFlight int
+	draining bool
+	closed   bool
+}
+
+// Status describes the state of an endpoint.
+type Status struct {
+	// Source is the configuration file the endpoint is defined in.
+	Source    string
+	Hosts     []string
+	Path      string
+	PathRegex string
+	Draining  bool
+	InFlight  int
+	// Plugins and Fallback are in chain order.
+	Plugins  []PluginStatus
+	Fallback []PluginStatus
+}
+
+// PluginStatus describes the state of a plugin of an endpoint's chain.
+type PluginStatus struct {
+	Name       string
+	SocketPath string
+	Replicas   []plugin.ReplicaStatus
+	// Builtin is set if the plugin runs inside the Aker process, without
+	// any replicas.
+	Builtin bool
+	// Circuit is empty unless the plugin has a circuit breaker.
+	Circuit plugin.CircuitState
+	// Users is the number of chain positions sharing the plugin, across
+	// all endpoints.
+	Users int
 }
 
 // NewHandler creates new endpoint handler. It opens all plugins specified
-// by endpoint using the provided Opener.
+// by endpoint using the provided Opener, including the fallback chain.
 func NewHandler(endpoint config.Endpoint, opener PluginOpener) (*Handler, error) {
-	if endpoint.Path == "" {
-		return nil, InvalidPathError("")
-	}
-	if endpoint.Plugins == nil || len(endpoint.Plugins) == 0 {
-		return nil, NoPluginsErr
+	if err := Validate(endpoint); err != nil {
+		return nil, err
 	}
 
-	chainBuilder := chainBuilder{opener}
-	pluginChain, err := chainBuilder.build(endpoint.Plugins)
+	timeout := time.Duration(endpoint.Timeout) * time.Second
+	chainBuilder := chainBuilder{
+		plugin:   opener,
+		endpoint: endpoint,
+		hub:      endpoint.ChainMode == HubMode,
+		timeout:  timeout,
+	}
+	plugins, pluginChain, err := chainBuilder.build(endpoint.Plugins)
 	if err != nil {
 		return nil, err
 	}
+	var fallback []*plugin.Plugin
+	var fallbackChain http.Handler
+	if len(endpoint.Fallback) > 0 {
+		fallbackBuilder := chainBuilder
+		fallbackBuilder.fallback = true
+		if fallback, fallbackChain, err = fallbackBuilder.build(endpoint.Fallback); err != nil {
+			chainBuilder.abort(plugins)
+			return nil, err
+		}
+	}
 
+	handler := &Handler{
+		path:          endpoint.Path,
+		config:        endpoint,
+		plugins:       plugins,
+		pluginChain:   pluginChain,
+		fallback:      fallback,
+		fallbackChain: fallbackChain,
+		timeout:       timeout,
+	}
+	handler.serve = http.HandlerFunc(handler.dispatch)
 	if endpoint.Audit {
-		pluginChain = logging.Handler(os.Stdout, pluginChain)
+		handler.serve = logging.Handler(os.Stdout, handler.serve)
 	}
+	handler.idle = sync.NewCond(&handler.mutex)
+	return handler, nil
+}
+
+// Config returns the endpoint configuration the handler was created with.
+func (h *Handler) Config() config.Endpoint {
+	return h.config
+}
+
+// Status returns the current state of the endpoint and its plugins.
+func (h *Handler) Status() Status {
+	h.mutex.Lock()
+	status := Status{
+		Source:    h.config.Source,
+		Hosts:     h.config.Hosts,
+		Path:      h.path,
+		PathRegex: h.config.PathRegex,
+		Draining:  h.draining,
+		InFlight:  h.inFlight,
+	}
+	h.mutex.Unlock()
+
+	status.Plugins = pluginStatus(h.plugins, h.config.Plugins)
+	status.Fallback = pluginStatus(h.fallback, h.config.Fallback)
+	return status
+}
+
+func pluginStatus(plugins []*plugin.Plugin, references []config.PluginReference) []PluginStatus {
+	var statuses []PluginStatus
+	for index, plug := range plugins {
+		statuses = append(statuses, PluginStatus{
+			Name:       references[index].Name,
+			SocketPath: plug.SocketPath(),
+			Replicas:   plug.Replicas(),
+			Builtin:    plug.Builtin(),
+			Circuit:    plug.Circuit(),
+			Users:      plug.Users(),
+		})
+	}
+	return statuses
+}
 
-	return &Handler{
-		path:        endpoint.Path,
-		pluginChain: pluginChain,
-	}, nil
+// RestartPlugin restarts the plugin at the specified position of the chain,
+// counting from zero.
+func (h *Handler) RestartPlugin(position int) error {
+	if position < 0 || position >= len(h.plugins) {
+		return InvalidPluginPositionError(position)
+	}
+	gologger.Infof("Restarting plugin %q of endpoint %q", h.config.Plugins[position].Name, h.path)
+	return h.plugins[position].Restart()
 }
 
-// ServeHTTP routes the incoming http.Request through the chain of aker plugins.
+// Drain stops accepting new requests and waits for the in-flight ones to
+// finish. The plugins keep running, so the endpoint can be resumed.
+func (h *Handler) Drain() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.draining = true
+	for h.inFlight > 0 {
+		h.idle.Wait()
+	}
+}
+
+// Resume accepts requests again after Drain.
+func (h *Handler) Resume() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.draining = false
+}
+
+// ServeHTTP routes the incoming http.Request through the chain of aker plugins,
+// or through the fallback chain while the circuit of a plugin is open.
+// Requests that arrive while the handler is drained or after it has been
+// closed are rejected with 503 Service Unavailable. Requests the chain does
+// not start responding to within the endpoint's timeout get a 504 Gateway
+// Timeout naming the plugin that did not respond.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.acquire() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer h.release()
+	// the deadline of a request is Aker's to set
+	req.Header.Del(plugin.DeadlineHeader)
+	if h.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), h.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	h.serve.ServeHTTP(w, req)
+}
+
+func (h *Handler) dispatch(w http.ResponseWriter, req *http.Request) {
+	if h.fallbackChain != nil && !available(h.plugins) {
+		h.fallbackChain.ServeHTTP(w, req)
+		return
+	}
 	h.pluginChain.ServeHTTP(w, req)
 }
 
+// available reports whether the circuits of all plugins are closed or let
+// probe requests through.
+func available(plugins []*plugin.Plugin) bool {
+	for _, plug := range plugins {
+		if !plug.Available() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close stops accepting new requests, waits for the in-flight ones to
+// finish and then closes all plugins of the chain in chain order, followed
+// by those of the fallback chain.
+// The first error encountered is returned, but all plugins are closed
+// regardless.
+func (h *Handler) Close() error {
+	h.mutex.Lock()
+	h.closed = true
+	for h.inFlight > 0 {
+		h.idle.Wait()
+	}
+	h.mutex.Unlock()
+
+	return closePlugins(append(append([]*plugin.Plugin{}, h.plugins...), h.fallback...))
+}
+
+func (h *Handler) acquire() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed || h.draining {
+		return false
+	}
+	h.inFlight++
+	return true
+}
+
+func (h *Handler) release() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.inFlight--
+	if h.inFlight == 0 {
+		h.idle.Broadcast()
+	}
+}
+
+// closePlugins closes the plugins in order. The first error encountered is
+// returned, but all plugins are closed regardless.
+func closePlugins(plugins []*plugin.Plugin) error {
+	var firstErr error
+	for _, plug := range plugins {
+		gologger.Infof("Closing plugin: %q", plug.Name())
+		if err := plug.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Validate checks that the endpoint has a single path, plugins and a
+// supported chain mode, without opening the plugins.
+func Validate(endpoint config.Endpoint) error {
+	if endpoint.Path == "" && endpoint.PathRegex == "" {
+		return InvalidPathError("")
+	}
+	if endpoint.Path != "" && endpoint.PathRegex != "" {
+		return InvalidPathError(endpoint.Path)
+	}
+	if endpoint.Plugins == nil || len(endpoint.Plugins) == 0 {
+		return NoPluginsErr
+	}
+	switch endpoint.ChainMode {
+	case "", ForwardMode, HubMode:
+	default:
+		return InvalidChainModeError(endpoint.ChainMode)
+	}
+	return nil
+}
+
+// ValidatePlugin checks the options of the referenced plugin, without
+// opening it. A builtin plugin must not have the options of plugin
+// processes.
+func ValidatePlugin(reference config.PluginReference) error {
+	options := pluginOptions(reference)
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if plugin.Registered(reference.Name) {
+		return options.CheckBuiltin(reference.Name)
+	}
+	return nil
+}
+
 type chainBuilder struct {
-	plugin PluginOpener
+	plugin   PluginOpener
+	endpoint config.Endpoint
+	// fallback is set while building the fallback chain.
+	fallback bool
+	// hub is set if Aker passes the requests on from plugin to plugin.
+	hub bool
+	// timeout is the time the chain is given to start responding.
+	timeout time.Duration
 }
 
-func (b *chainBuilder) build(references []config.PluginReference) (http.Handler, error) {
-	index := len(references) - 1
-	lastPlugin, err := b.buildPlugin(references[index], nil)
-	if err != nil {
-		return nil, err
+// build opens the referenced plugins from last to first, so that each of
+// them knows where to forward requests to, and waits for all of them to
+// become ready. The returned plugins are in chain order, followed by the
+// handler passing requests through the chain.
+//
+// In hub mode, the plugins do not forward requests, so that a plugin opened
+// with the same configuration at different positions can be shared.
+//
+// Building is all or nothing: if a plugin fails to start, the plugins that
+// were already started are closed again and a *ChainError is returned.
+func (b *chainBuilder) build(references []config.PluginReference) ([]*plugin.Plugin, http.Handler, error) {
+	plugins := make([]*plugin.Plugin, len(references))
+	var next *plugin.Plugin
+	for index := len(references) - 1; index >= 0; index-- {
+		plug, err := b.buildPlugin(references[index], next)
+		if err != nil {
+			b.abort(plugins[index+1:])
+			return nil, nil, b.chainError(index, references[index], err)
+		}
+		plugins[index] = plug
+		if !b.hub {
+			next = plug
+		}
 	}
-	for index > 0 {
-		index--
-		lastPlugin, err = b.buildPlugin(references[index], lastPlugin)
+
+	// The plugins are all starting at the same time, so the total wait is as
+	// long as the slowest plugin takes.
+	handshakes := make([]plugin.Handshake, len(plugins))
+	for index, plug := range plugins {
+		timeout := plugin.DefaultReadyTimeout
+		if references[index].ReadyTimeout > 0 {
+			timeout = time.Duration(references[index].ReadyTimeout) * time.Second
+		}
+		handshake, err := plug.WaitReady(timeout)
 		if err != nil {
-			return nil, err
+			b.abort(plugins)
+			return nil, nil, b.chainError(index, references[index], err)
 		}
+		handshakes[index] = handshake
+	}
+
+	if !b.hub {
+		return plugins, b.hopHandler(plugins[0], references[0]), nil
+	}
+	chain := &hubChain{body: bodyBuffer(b.endpoint.BodyBuffer)}
+	for index, plug := range plugins {
+		chain.hops = append(chain.hops, hop{
+			name:        references[index].Name,
+			handler:     b.hopHandler(plug, references[index]),
+			headersOnly: handshakes[index].HasCapability(plugin.CapabilityHeadersOnly),
+		})
 	}
-	return lastPlugin, nil
+	return plugins, chain, nil
+}
+
+// hopHandler returns the handler passing requests on to a plugin, which
+// replies with a gateway timeout if the plugin does not respond in time.
+// In forward mode, this is the first plugin of the chain only, and the
+// plugins pass the deadline on to each other, naming the plugin that timed
+// out in their replies.
+func (b *chainBuilder) hopHandler(plug *plugin.Plugin, reference config.PluginReference) http.Handler {
+	if b.timeout <= 0 && plug.ResponseTimeout() <= 0 {
+		return plug
+	}
+	return plugin.TimeoutHandler(plug, reference.Name, plug.ResponseTimeout(), requestID)
+}
+
+// abort closes the plugins of a chain that could not be built.
+func (b *chainBuilder) abort(plugins []*plugin.Plugin) {
+	if err := closePlugins(plugins); err != nil {
+		gologger.Errorf("Error closing the plugins of endpoint %q: %v", endpointName(b.endpoint), err)
+	}
+}
+
+func (b *chainBuilder) chainError(index int, reference config.PluginReference, err error) error {
+	return &ChainError{
+		Endpoint: endpointName(b.endpoint),
+		Fallback: b.fallback,
+		Position: index,
+		Plugin:   reference.Name,
+		Err:      err,
+	}
+}
+
+// endpointName returns the path or the path regex of the endpoint.
+func endpointName(endpoint config.Endpoint) string {
+	if endpoint.Path != "" {
+		return endpoint.Path
+	}
+	return endpoint.PathRegex
 }
 
 func (b *chainBuilder) buildPlugin(reference config.PluginReference, next *plugin.Plugin) (*plugin.Plugin, error) {
@@ -83,9 +419,67 @@ func (b *chainBuilder) buildPlugin(reference config.PluginReference, next *plugi
 	}
 
 	gologger.Infof("Opening plugin: %q", reference.Name)
-	plug, err := b.plugin.Open(reference.Name, cfgData, next)
+	options := pluginOptions(reference)
+	options.Hub = b.hub
+	plug, err := b.plugin.Open(reference.Name, cfgData, next, options)
 	if err != nil {
 		return nil, err
 	}
 	return plug, nil
 }
+
+func pluginOptions(reference config.PluginReference) plugin.Options {
+	policy := reference.RestartPolicy
+	breaker := reference.CircuitBreaker
+	return plugin.Options{
+		RestartPolicy: plugin.RestartPolicy{
+			Mode:        plugin.RestartMode(policy.Mode),
+			MaxRestarts: policy.MaxRestarts,
+			Backoff:     time.Duration(policy.Backoff) * time.Second,
+			MaxBackoff:  time.Duration(policy.MaxBackoff) * time.Second,
+		},
+		Replicas:        reference.Replicas,
+		LoadBalancing:   plugin.LoadBalancing(reference.LoadBalancing),
+		Args:            reference.Args,
+		Env:             environment(reference.Env),
+		CleanEnv:        reference.CleanEnv,
+		Dir:             reference.Dir,
+		ResponseTimeout: time.Duration(reference.ResponseTimeout) * time.Second,
+		CircuitBreaker: plugin.CircuitBreaker{
+			ConsecutiveFailures: breaker.ConsecutiveFailures,
+			FailureRate:         breaker.FailureRate,
+			Window:              breaker.Window,
+			OpenTimeout:         time.Duration(breaker.OpenTimeout) * time.Second,
+			HalfOpenRequests:    breaker.HalfOpenRequests,
+		},
+		BodyBuffer: bodyBuffer(reference.BodyBuffer),
+	}
+}
+
+func bodyBuffer(buffer config.BodyBuffer) plugin.BodyBuffer {
+	return plugin.BodyBuffer{
+		MemoryLimit: buffer.MemoryLimit,
+		SpillDir:    buffer.SpillDir,
+		MaxSize:     buffer.MaxSize,
+	}
+}
+
+// requestID returns the ID stored in the request context by the request ID
+// policy.
+func requestID(req *http.Request) string {
+	id, _ := requestid.FromContext(req.Context())
+	return id
+}
+
+// environment turns the variables into sorted "KEY=value" entries.
+func environment(variables map[string]string) []string {
+	if len(variables) == 0 {
+		return nil
+	}
+	env := make([]string, 0, len(variables))
+	for name, value := range variables {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
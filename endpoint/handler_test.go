@@ -2,11 +2,20 @@ package endpoint_test
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/SAP/aker/config"
 	. "github.com/SAP/aker/endpoint"
 	"github.com/SAP/aker/endpoint/endpointfakes"
 	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/requestid"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -42,6 +51,30 @@ var _ = Describe("Handler", func() {
 		})
 	})
 
+	Context("when created with both a path and a path regex", func() {
+		BeforeEach(func() {
+			endpoint = config.Endpoint{Path: "/api/", PathRegex: "^/api/"}
+		})
+
+		It("should have returned an error", func() {
+			Ω(err).Should(Equal(InvalidPathError("/api/")))
+		})
+	})
+
+	Context("when created with an unsupported chain mode", func() {
+		BeforeEach(func() {
+			endpoint = config.Endpoint{
+				Path:      "/",
+				ChainMode: "mesh",
+				Plugins:   []config.PluginReference{{Name: "happy-unicorn"}},
+			}
+		})
+
+		It("should have returned an error", func() {
+			Ω(err).Should(Equal(InvalidChainModeError("mesh")))
+		})
+	})
+
 	Context("when created with no plugin configuration", func() {
 		BeforeEach(func() {
 			endpoint = config.Endpoint{
@@ -61,7 +94,7 @@ var _ = Describe("Handler", func() {
 
 	Context("when created with valid configuration", func() {
 		BeforeEach(func() {
-			endpoint.Path = "/"
+			endpoint = config.Endpoint{Path: "/", Source: "config.yml"}
 			endpoint.Plugins = []config.PluginReference{
 				config.PluginReference{
 					Name: "happy-unicorn",
@@ -71,11 +104,33 @@ var _ = Describe("Handler", func() {
 					Config: config.PluginConfig{
 						"fly": "no",
 					},
+					RestartPolicy: config.RestartPolicy{
+						Mode:        "always",
+						MaxRestarts: 3,
+						Backoff:     2,
+						MaxBackoff:  20,
+					},
+					Replicas:        4,
+					LoadBalancing:   "least-in-flight",
+					Args:            []string{"--fly=never"},
+					Env:             map[string]string{"LEGS": "6", "COLOR": "green"},
+					CleanEnv:        true,
+					Dir:             "/var/lib/grasshopper",
+					ResponseTimeout: 5,
+					BodyBuffer: config.BodyBuffer{
+						MemoryLimit: 4096,
+						SpillDir:    "/var/tmp",
+						MaxSize:     1 << 20,
+					},
 				},
 			}
 
-			opener.OpenStub = func(name string, _ []byte, next *plugin.Plugin) (*plugin.Plugin, error) {
-				return &plugin.Plugin{}, nil
+			opener.OpenStub = func(name string, _ []byte, next *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+				return &plugin.Plugin{
+					Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+						w.WriteHeader(http.StatusOK)
+					}),
+				}, nil
 			}
 		})
 
@@ -84,8 +139,13 @@ var _ = Describe("Handler", func() {
 				opener.OpenReturns(nil, errors.New("unable to open plugin"))
 			})
 
-			It("should have returned an error", func() {
-				Ω(err).Should(HaveOccurred())
+			It("should have returned an error naming the plugin", func() {
+				Ω(err).Should(Equal(&ChainError{
+					Endpoint: "/",
+					Position: 1,
+					Plugin:   "mighty-grasshopper",
+					Err:      errors.New("unable to open plugin"),
+				}))
 			})
 
 			It("should have returned nil handler", func() {
@@ -93,6 +153,50 @@ var _ = Describe("Handler", func() {
 			})
 		})
 
+		Context("but a plugin at the front of the chain fails to start", func() {
+			var opened []*plugin.Plugin
+
+			BeforeEach(func() {
+				opened = nil
+				endpoint.Plugins = append([]config.PluginReference{
+					config.PluginReference{Name: "grumpy-badger"},
+				}, endpoint.Plugins...)
+
+				pluginOpener := new(endpointfakes.FakePluginOpener)
+				pluginOpener.OpenStub = func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+					if name == "grumpy-badger" {
+						return nil, errors.New("badger refuses to start")
+					}
+					return &plugin.Plugin{}, nil
+				}
+				pool := plugin.NewPool(pluginOpener)
+				opener.OpenStub = func(name string, config []byte, next *plugin.Plugin, options plugin.Options) (*plugin.Plugin, error) {
+					plug, err := pool.Open(name, config, next, options)
+					if err == nil {
+						opened = append(opened, plug)
+					}
+					return plug, err
+				}
+			})
+
+			It("should have returned an error naming the plugin", func() {
+				Ω(err).Should(Equal(&ChainError{
+					Endpoint: "/",
+					Position: 0,
+					Plugin:   "grumpy-badger",
+					Err:      errors.New("badger refuses to start"),
+				}))
+				Ω(err.Error()).Should(Equal(`endpoint "/": plugin "grumpy-badger" at position 0: badger refuses to start`))
+			})
+
+			It("should have closed the plugins started before", func() {
+				Ω(opened).Should(HaveLen(2))
+				for _, plug := range opened {
+					Ω(plug.Close()).Should(Equal(plugin.PluginClosedErr))
+				}
+			})
+		})
+
 		It("should have not returned an error", func() {
 			Ω(err).ShouldNot(HaveOccurred())
 		})
@@ -100,19 +204,421 @@ var _ = Describe("Handler", func() {
 		It("should have opened the plugins in reverse order", func() {
 			Ω(opener.OpenCallCount()).Should(Equal(2))
 
-			nameArg, configArg, nextArg := opener.OpenArgsForCall(0)
+			nameArg, configArg, nextArg, _ := opener.OpenArgsForCall(0)
 			Ω(nameArg).Should(Equal("mighty-grasshopper"))
 			Ω(configArg).Should(Equal([]byte(`fly: "no"` + "\n")))
 			Ω(nextArg).Should(BeNil())
 
-			nameArg, configArg, nextArg = opener.OpenArgsForCall(1)
+			nameArg, configArg, nextArg, _ = opener.OpenArgsForCall(1)
 			Ω(nameArg).Should(Equal("happy-unicorn"))
 			Ω(configArg).Should(Equal([]byte("{}\n")))
 			Ω(nextArg).ShouldNot(BeNil())
 		})
 
+		It("should have passed the restart policy of each plugin", func() {
+			_, _, _, optionsArg := opener.OpenArgsForCall(0)
+			Ω(optionsArg.RestartPolicy).Should(Equal(plugin.RestartPolicy{
+				Mode:        plugin.RestartAlways,
+				MaxRestarts: 3,
+				Backoff:     2 * time.Second,
+				MaxBackoff:  20 * time.Second,
+			}))
+
+			_, _, _, optionsArg = opener.OpenArgsForCall(1)
+			Ω(optionsArg.RestartPolicy).Should(Equal(plugin.RestartPolicy{}))
+		})
+
+		It("should have passed the replica settings of each plugin", func() {
+			_, _, _, optionsArg := opener.OpenArgsForCall(0)
+			Ω(optionsArg.Replicas).Should(Equal(4))
+			Ω(optionsArg.LoadBalancing).Should(Equal(plugin.LeastInFlight))
+
+			_, _, _, optionsArg = opener.OpenArgsForCall(1)
+			Ω(optionsArg.Replicas).Should(BeZero())
+		})
+
+		It("should have passed the process options of each plugin", func() {
+			_, _, _, optionsArg := opener.OpenArgsForCall(0)
+			Ω(optionsArg.Args).Should(Equal([]string{"--fly=never"}))
+			Ω(optionsArg.Env).Should(Equal([]string{"COLOR=green", "LEGS=6"}))
+			Ω(optionsArg.CleanEnv).Should(BeTrue())
+			Ω(optionsArg.Dir).Should(Equal("/var/lib/grasshopper"))
+			Ω(optionsArg.ResponseTimeout).Should(Equal(5 * time.Second))
+			Ω(optionsArg.BodyBuffer).Should(Equal(plugin.BodyBuffer{
+				MemoryLimit: 4096,
+				SpillDir:    "/var/tmp",
+				MaxSize:     1 << 20,
+			}))
+
+			_, _, _, optionsArg = opener.OpenArgsForCall(1)
+			Ω(optionsArg.Args).Should(BeNil())
+			Ω(optionsArg.Env).Should(BeNil())
+			Ω(optionsArg.CleanEnv).Should(BeFalse())
+		})
+
 		It("should have not returned nil", func() {
 			Ω(handler).ShouldNot(BeNil())
 		})
+
+		It("should return the endpoint configuration", func() {
+			Ω(handler.Config()).Should(Equal(endpoint))
+		})
+
+		It("should report the plugins of the chain", func() {
+			status := handler.Status()
+			Ω(status.Source).Should(Equal("config.yml"))
+			Ω(status.Path).Should(Equal("/"))
+			Ω(status.Draining).Should(BeFalse())
+			Ω(status.Plugins).Should(HaveLen(2))
+			Ω(status.Plugins[0].Name).Should(Equal("happy-unicorn"))
+			Ω(status.Plugins[1].Name).Should(Equal("mighty-grasshopper"))
+		})
+
+		It("should refuse to restart a plugin outside of the chain", func() {
+			Ω(handler.RestartPlugin(2)).Should(Equal(InvalidPluginPositionError(2)))
+		})
+
+		Context("and then drained", func() {
+			serve := func() int {
+				req, err := http.NewRequest("GET", "http://aker.me/", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				return rr.Code
+			}
+
+			JustBeforeEach(func() {
+				handler.Drain()
+			})
+
+			It("should reject incoming requests", func() {
+				Ω(serve()).Should(Equal(http.StatusServiceUnavailable))
+				Ω(handler.Status().Draining).Should(BeTrue())
+			})
+
+			It("should accept requests again when resumed", func() {
+				handler.Resume()
+				Ω(serve()).Should(Equal(http.StatusOK))
+			})
+		})
+
+		Context("and a fallback chain", func() {
+			BeforeEach(func() {
+				endpoint.Fallback = []config.PluginReference{
+					config.PluginReference{
+						Name: "sleepy-koala",
+						CircuitBreaker: config.CircuitBreaker{
+							ConsecutiveFailures: 5,
+							FailureRate:         0.5,
+							Window:              10,
+							OpenTimeout:         60,
+							HalfOpenRequests:    2,
+						},
+					},
+				}
+			})
+
+			It("should have opened the fallback plugins after the chain", func() {
+				Ω(opener.OpenCallCount()).Should(Equal(3))
+				nameArg, _, nextArg, optionsArg := opener.OpenArgsForCall(2)
+				Ω(nameArg).Should(Equal("sleepy-koala"))
+				Ω(nextArg).Should(BeNil())
+				Ω(optionsArg.CircuitBreaker).Should(Equal(plugin.CircuitBreaker{
+					ConsecutiveFailures: 5,
+					FailureRate:         0.5,
+					Window:              10,
+					OpenTimeout:         time.Minute,
+					HalfOpenRequests:    2,
+				}))
+			})
+
+			It("should report the plugins of the fallback chain", func() {
+				status := handler.Status()
+				Ω(status.Fallback).Should(HaveLen(1))
+				Ω(status.Fallback[0].Name).Should(Equal("sleepy-koala"))
+				Ω(status.Fallback[0].Circuit).Should(BeEmpty())
+			})
+
+			It("should serve requests with the chain while its plugins are available", func() {
+				req, err := http.NewRequest("GET", "http://aker.me/", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				Ω(rr.Code).Should(Equal(http.StatusOK))
+			})
+
+			Context("but a fallback plugin fails to start", func() {
+				var opened []*plugin.Plugin
+
+				BeforeEach(func() {
+					opened = nil
+					pool := plugin.NewPool(&endpointfakes.FakePluginOpener{
+						OpenStub: func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+							if name == "sleepy-koala" {
+								return nil, errors.New("koala is asleep")
+							}
+							return &plugin.Plugin{}, nil
+						},
+					})
+					opener.OpenStub = func(name string, config []byte, next *plugin.Plugin, options plugin.Options) (*plugin.Plugin, error) {
+						plug, err := pool.Open(name, config, next, options)
+						if err == nil {
+							opened = append(opened, plug)
+						}
+						return plug, err
+					}
+				})
+
+				It("should have returned an error naming the fallback plugin", func() {
+					Ω(err).Should(Equal(&ChainError{
+						Endpoint: "/",
+						Fallback: true,
+						Position: 0,
+						Plugin:   "sleepy-koala",
+						Err:      errors.New("koala is asleep"),
+					}))
+					Ω(err.Error()).Should(Equal(`endpoint "/": fallback plugin "sleepy-koala" at position 0: koala is asleep`))
+				})
+
+				It("should have closed the plugins of the chain", func() {
+					Ω(opened).Should(HaveLen(2))
+					for _, plug := range opened {
+						Ω(plug.Close()).Should(Equal(plugin.PluginClosedErr))
+					}
+				})
+			})
+		})
+
+		Context("and a timeout", func() {
+			BeforeEach(func() {
+				endpoint.Timeout = 1
+				opener.OpenStub = func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+					return &plugin.Plugin{
+						Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							<-req.Context().Done()
+						}),
+					}, nil
+				}
+			})
+
+			It("should reply with a gateway timeout naming the first plugin if it does not respond", func() {
+				req, err := http.NewRequest("GET", "http://aker.me/", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				req = req.WithContext(requestid.NewContext(req.Context(), "0815"))
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				Ω(rr.Code).Should(Equal(http.StatusGatewayTimeout))
+				Ω(rr.Body.String()).Should(ContainSubstring(`plugin "happy-unicorn" did not respond in time (request ID 0815)`))
+			})
+
+			Context("when a later plugin does not respond in time", func() {
+				var deadline string
+
+				BeforeEach(func() {
+					opener.OpenStub = func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+						return &plugin.Plugin{
+							Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+								deadline = req.Header.Get(plugin.DeadlineHeader)
+								w.Header().Set(plugin.TimedOutHeader, "mighty-grasshopper")
+								w.WriteHeader(http.StatusGatewayTimeout)
+							}),
+						}, nil
+					}
+				})
+
+				It("should reply with a gateway timeout naming that plugin", func() {
+					req, err := http.NewRequest("GET", "http://aker.me/", nil)
+					Ω(err).ShouldNot(HaveOccurred())
+					req.Header.Set(plugin.DeadlineHeader, time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+					req = req.WithContext(requestid.NewContext(req.Context(), "0815"))
+					rr := httptest.NewRecorder()
+					handler.ServeHTTP(rr, req)
+					Ω(rr.Code).Should(Equal(http.StatusGatewayTimeout))
+					Ω(rr.Body.String()).Should(ContainSubstring(`plugin "mighty-grasshopper" did not respond in time (request ID 0815)`))
+
+					passedOn, err := time.Parse(time.RFC3339Nano, deadline)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(passedOn).Should(BeTemporally("<", time.Now().Add(time.Second)))
+				})
+			})
+		})
+
+		Context("and the hub chain mode", func() {
+			var bodies []string
+
+			BeforeEach(func() {
+				endpoint.ChainMode = HubMode
+				bodies = nil
+				opener.OpenStub = func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+					return &plugin.Plugin{
+						Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							data, _ := ioutil.ReadAll(req.Body)
+							bodies = append(bodies, string(data))
+							if name == "happy-unicorn" {
+								w.Header().Set(plugin.ContinueHeader, "true")
+								fmt.Fprint(w, `{"method":"POST","url":"/checked","header":{"X-User":["unicorn"]},"response_header":{"X-Checked":["true"]}}`)
+								return
+							}
+							if req.Header.Get("X-User") == "unicorn" {
+								w.Header().Set("X-Path", req.URL.Path)
+							}
+							w.WriteHeader(http.StatusAccepted)
+						}),
+					}, nil
+				}
+			})
+
+			It("should have opened the plugins in hub mode without a next plugin", func() {
+				Ω(opener.OpenCallCount()).Should(Equal(2))
+				for index := 0; index < 2; index++ {
+					_, _, nextArg, optionsArg := opener.OpenArgsForCall(index)
+					Ω(nextArg).Should(BeNil())
+					Ω(optionsArg.Hub).Should(BeTrue())
+				}
+			})
+
+			It("should pass requests on from plugin to plugin", func() {
+				req := httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				Ω(rr.Code).Should(Equal(http.StatusAccepted))
+				Ω(rr.Header().Get("X-Path")).Should(Equal("/checked"))
+				Ω(rr.Header().Get("X-Checked")).Should(Equal("true"))
+				Ω(rr.Header().Get(plugin.ContinueHeader)).Should(BeEmpty())
+				Ω(bodies).Should(Equal([]string{"payload", "payload"}))
+			})
+
+			Context("and a timeout", func() {
+				BeforeEach(func() {
+					endpoint.Timeout = 1
+					open := opener.OpenStub
+					opener.OpenStub = func(name string, config []byte, next *plugin.Plugin, options plugin.Options) (*plugin.Plugin, error) {
+						if name == "happy-unicorn" {
+							return open(name, config, next, options)
+						}
+						return &plugin.Plugin{
+							Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+								<-req.Context().Done()
+							}),
+						}, nil
+					}
+				})
+
+				It("should reply with a gateway timeout naming the plugin that did not respond", func() {
+					req := httptest.NewRequest("GET", "/", nil)
+					req = req.WithContext(requestid.NewContext(req.Context(), "0815"))
+					rr := httptest.NewRecorder()
+					handler.ServeHTTP(rr, req)
+					Ω(rr.Code).Should(Equal(http.StatusGatewayTimeout))
+					Ω(rr.Body.String()).Should(ContainSubstring(`plugin "mighty-grasshopper" did not respond in time (request ID 0815)`))
+				})
+			})
+
+			Context("and a plugin at several positions", func() {
+				var opens int
+
+				BeforeEach(func() {
+					opens = 0
+					pool := plugin.NewPool(&endpointfakes.FakePluginOpener{
+						OpenStub: func(string, []byte, *plugin.Plugin, plugin.Options) (*plugin.Plugin, error) {
+							opens++
+							return &plugin.Plugin{}, nil
+						},
+					})
+					opener.OpenStub = pool.Open
+					endpoint.Plugins = append(endpoint.Plugins, endpoint.Plugins[0])
+				})
+
+				It("should share the plugin between the positions", func() {
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(opens).Should(Equal(2))
+				})
+			})
+		})
+
+		Context("and then closed", func() {
+			JustBeforeEach(func() {
+				Ω(handler.Close()).Should(Succeed())
+			})
+
+			It("should reject incoming requests", func() {
+				req, err := http.NewRequest("GET", "http://aker.me/", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				Ω(rr.Code).Should(Equal(http.StatusServiceUnavailable))
+			})
+		})
+	})
+})
+
+var _ = Describe("Plugin configuration", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "aker-endpoint")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should reach the plugin as Aker has read it", func() {
+		path := filepath.Join(dir, "config.yml")
+		Ω(ioutil.WriteFile(path, []byte(`endpoints:
+  - path: /
+    plugins:
+      - name: picky-plugin
+        configuration:
+          mode: on
+          answer: yes
+          enabled: true
+          permissions: 0755
+          version: 1.10
+`), 0600)).Should(Succeed())
+		cfg, err := config.LoadFromFile(path)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		opener := new(endpointfakes.FakePluginOpener)
+		_, err = NewHandler(cfg.Endpoints[0], opener)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, data, _, _ := opener.OpenArgsForCall(0)
+		var received map[string]interface{}
+		Ω(plugin.UnmarshalConfig(data, &received)).Should(Succeed())
+		Ω(received).Should(Equal(map[string]interface{}(cfg.Endpoints[0].Plugins[0].Config)))
+		Ω(received).Should(Equal(map[string]interface{}{
+			"mode":        "on",
+			"answer":      "yes",
+			"enabled":     true,
+			"permissions": 0755,
+			"version":     1.1,
+		}))
+	})
+})
+
+var _ = Describe("ValidatePlugin", func() {
+	It("should accept supported options", func() {
+		Ω(ValidatePlugin(config.PluginReference{
+			Name:          "plugin",
+			RestartPolicy: config.RestartPolicy{Mode: "always"},
+			LoadBalancing: "least-in-flight",
+		})).Should(Succeed())
+	})
+
+	It("should reject unsupported restart modes", func() {
+		Ω(ValidatePlugin(config.PluginReference{
+			Name:          "plugin",
+			RestartPolicy: config.RestartPolicy{Mode: "sometimes"},
+		})).Should(Equal(plugin.UnsupportedRestartModeError("sometimes")))
+	})
+
+	It("should reject unsupported load balancing", func() {
+		Ω(ValidatePlugin(config.PluginReference{
+			Name:          "plugin",
+			LoadBalancing: "random",
+		})).Should(Equal(plugin.UnsupportedLoadBalancingError("random")))
 	})
 })
@@ -0,0 +1,70 @@
+package endpoint
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SAP/aker/plugin"
+	"github.com/SAP/gologger"
+)
+
+// Chain modes an endpoint may be configured with.
+const (
+	// ForwardMode lets each plugin forward requests to the next plugin
+	// itself. It is the default.
+	ForwardMode = "forward"
+	// HubMode lets each plugin return requests to Aker, which passes them on
+	// to the next plugin.
+	HubMode = "hub"
+)
+
+// hubChain passes requests through a chain in hub mode. Each plugin is given
+// its own timeout, and the request body is buffered once for all of them.
+type hubChain struct {
+	hops []hop
+	body plugin.BodyBuffer
+}
+
+// hop is a plugin of a chain in hub mode.
+type hop struct {
+	name    string
+	handler http.Handler
+	// headersOnly is set if the plugin does not read the request body.
+	headersOnly bool
+}
+
+func (c *hubChain) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body := req.Body
+	passOn := func() io.ReadCloser {
+		return body
+	}
+	if len(c.hops) > 1 && req.Body != nil && req.Body != http.NoBody {
+		buffer, err := plugin.BufferBody(req.Body, c.body)
+		if err != nil {
+			plugin.RejectBody(w, err, gologger.DefaultLogger)
+			return
+		}
+		defer buffer.Close()
+		passOn = buffer.Reader
+	}
+
+	for _, hop := range c.hops {
+		req.Body = passOn()
+		if hop.headersOnly {
+			req.Body = http.NoBody
+		}
+		startedAt := time.Now()
+		next, err := plugin.ServeHop(hop.handler, w, req)
+		gologger.Debugf("Plugin %q served %s %s in %v", hop.name, req.Method, req.URL.Path, time.Since(startedAt))
+		if err != nil {
+			gologger.Errorf("Error passing the request on from plugin %q: %v", hop.name, err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		if next == nil {
+			return
+		}
+		req = next
+	}
+}
@@ -0,0 +1,52 @@
+package endpoint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/SAP/aker/config"
+)
+
+// SharingWarnings describes the plugin definitions that cannot be shared
+// between the endpoints using them. In forward mode, a plugin forwards
+// requests to a fixed next plugin, so the uses of a definition in front of
+// different plugins run in processes of their own.
+func SharingWarnings(endpoints []config.Endpoint) []string {
+	tails := make(map[string]map[string]bool)
+	for _, endpointCfg := range endpoints {
+		if endpointCfg.ChainMode == HubMode {
+			continue
+		}
+		for _, chain := range [][]config.PluginReference{endpointCfg.Plugins, endpointCfg.Fallback} {
+			for index, reference := range chain {
+				if reference.Use == "" {
+					continue
+				}
+				if tails[reference.Use] == nil {
+					tails[reference.Use] = make(map[string]bool)
+				}
+				tails[reference.Use][tailKey(chain[index+1:])] = true
+			}
+		}
+	}
+
+	var warnings []string
+	for name, followers := range tails {
+		if len(followers) > 1 {
+			warnings = append(warnings, fmt.Sprintf("plugin %q is followed by different plugins in forward mode and runs once for each of them, use the hub chain mode to share it", name))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// tailKey identifies the plugins following a plugin by their settings, no
+// matter whether they come from a definition.
+func tailKey(tail []config.PluginReference) string {
+	references := make([]config.PluginReference, len(tail))
+	for index, reference := range tail {
+		reference.Use = ""
+		references[index] = reference
+	}
+	return fmt.Sprintf("%+v", references)
+}
@@ -0,0 +1,40 @@
+package endpoint_test
+
+import (
+	"github.com/SAP/aker/config"
+	. "github.com/SAP/aker/endpoint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SharingWarnings", func() {
+	auth := config.PluginReference{Use: "auth", Name: "aker-auth-plugin"}
+	proxy := func(url string) config.PluginReference {
+		return config.PluginReference{Name: "aker-proxy-plugin", Config: config.PluginConfig{"url": url}}
+	}
+
+	It("should accept definitions followed by the same plugins", func() {
+		Ω(SharingWarnings([]config.Endpoint{
+			{Path: "/api/", Plugins: []config.PluginReference{auth, proxy("http://api")}},
+			{Path: "/v2/api/", Plugins: []config.PluginReference{auth, proxy("http://api")}},
+		})).Should(BeEmpty())
+	})
+
+	It("should warn about definitions followed by different plugins", func() {
+		Ω(SharingWarnings([]config.Endpoint{
+			{Path: "/api/", Plugins: []config.PluginReference{auth, proxy("http://api")}},
+			{Path: "/admin/", Plugins: []config.PluginReference{auth, proxy("http://admin")}},
+			{Path: "/ping/", Plugins: []config.PluginReference{auth}},
+		})).Should(Equal([]string{
+			`plugin "auth" is followed by different plugins in forward mode and runs once for each of them, use the hub chain mode to share it`,
+		}))
+	})
+
+	It("should accept definitions shared in hub mode", func() {
+		Ω(SharingWarnings([]config.Endpoint{
+			{Path: "/api/", ChainMode: HubMode, Plugins: []config.PluginReference{auth, proxy("http://api")}},
+			{Path: "/admin/", ChainMode: HubMode, Plugins: []config.PluginReference{auth, proxy("http://admin")}},
+		})).Should(BeEmpty())
+	})
+})
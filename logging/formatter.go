@@ -3,6 +3,8 @@ package logging
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/SAP/aker/requestid"
 )
 
 //go:generate counterfeiter . Formatter
@@ -30,9 +32,19 @@ func (f defaultFormatter) Format(e *AccessEntry) string {
 		formatHeader(e.Request, "Referer"),
 		formatHeader(e.Request, "User-Agent"),
 		e.Request.RemoteAddr,
-		formatHeader(e.Request, "X-Aker-Request-Id"),
+		formatRequestID(e.Request),
 		e.FinishedAt.Sub(e.StartedAt).Seconds())
 }
+
+// formatRequestID returns the ID assigned to the request, which is carried by
+// a configurable header.
+func formatRequestID(req *http.Request) string {
+	if id, ok := requestid.FromContext(req.Context()); ok {
+		return id
+	}
+	return formatHeader(req, requestid.DefaultHeader)
+}
+
 func formatHeader(req *http.Request, name string) string {
 	v := req.Header.Get(name)
 	if v == "" {
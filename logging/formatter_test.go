@@ -9,6 +9,7 @@ import (
 
 	. "github.com/SAP/aker/logging"
 	"github.com/SAP/aker/logging/fakes"
+	"github.com/SAP/aker/requestid"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -62,6 +63,14 @@ var _ = Describe("DefaultFormatter", func() {
 				FinishedAt: now.Add(time.Second),
 			},
 			`test.me - [01/01/0001:00:00:00 +0000] "GET /v2 HTTP/1.1" 200 0 42 "-" "-"  aker_request_id:15 response_time:1.000000`+"\n"),
+		Entry("Request ID in context",
+			&AccessEntry{
+				Request:    requestWithID("GET", url, "abc"),
+				Response:   response(http.StatusOK, 42),
+				StartedAt:  now,
+				FinishedAt: now.Add(time.Second),
+			},
+			`test.me - [01/01/0001:00:00:00 +0000] "GET /v2 HTTP/1.1" 200 0 42 "-" "-"  aker_request_id:abc response_time:1.000000`+"\n"),
 		Entry("User-Agent",
 			&AccessEntry{
 				Request:    requestWithHeader("GET", url, "", "User-Agent:mozilla"),
@@ -99,6 +108,11 @@ func requestWithHeader(method, path, body, header string) *http.Request {
 	return req
 }
 
+func requestWithID(method, path, id string) *http.Request {
+	req := request(method, path, "")
+	return req.WithContext(requestid.NewContext(req.Context(), id))
+}
+
 func response(status, size int) ResponseRecorder {
 	resp := new(fakes.FakeResponseRecorder)
 	resp.StatusReturns(status)
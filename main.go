@@ -1,78 +1,184 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/SAP/aker/admin"
 	"github.com/SAP/aker/config"
-	"github.com/SAP/aker/endpoint"
+	"github.com/SAP/aker/metrics"
 	"github.com/SAP/aker/plugin"
-	"github.com/SAP/aker/uuid"
+	"github.com/SAP/aker/requestid"
+	"github.com/SAP/aker/router"
+	"github.com/SAP/aker/tlsconfig"
 	"github.com/SAP/gologger"
 )
 
+// defaultShutdownTimeout is the time in-flight requests are given to finish
+// on shutdown, unless configured otherwise.
+const defaultShutdownTimeout = 30 * time.Second
+
 var configLocationFlag = flag.String(
 	"config",
 	"config.yml",
 	"Specifies the configuration file location.",
 )
 
+var checkFlag = flag.Bool(
+	"check",
+	false,
+	"Checks the configuration file and exits without starting anything.",
+)
+
 func main() {
 	flag.Parse()
 
+	if *checkFlag {
+		if !check(*configLocationFlag, os.Stderr) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := config.LoadFromFile(*configLocationFlag)
 	if err != nil {
 		gologger.Fatalf("Failed to load configuration due to %q", err.Error())
 	}
-	mux := http.NewServeMux()
-	for _, endpointCfg := range cfg.Endpoints {
-		endpointHandler, err := endpoint.NewHandler(endpointCfg, plugin.DefaultOpener)
+
+	var tlsConfig *tls.Config
+	if cfg.Server.TLS != nil {
+		tlsConfig, err = tlsconfig.New(*cfg.Server.TLS)
 		if err != nil {
-			gologger.Fatalf("Failed to build plugin chain due to %q", err.Error())
+			gologger.Fatalf("Failed to configure TLS due to %q", err.Error())
 		}
-		mux.Handle(endpointCfg.Path, endpointHandler)
 	}
 
-	handler := NewHeaderSticker(mux, map[string]func() string{
-		"X-Aker-Request-Id": func() string {
-			uid, _ := uuid.Random()
-			return uid.String()
-		},
-	})
+	requestIDs, err := requestid.New(cfg.Server.RequestID)
+	if err != nil {
+		gologger.Fatalf("Failed to configure request IDs due to %q", err.Error())
+	}
+
+	// the signals are handled from here on, so that a signal arriving while
+	// the plugins start does not leave them orphaned
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	opener := &plugin.Opener{
+		PluginStdout:    os.Stdout,
+		PluginStderr:    os.Stderr,
+		StopTimeout:     time.Duration(cfg.Server.PluginStopTimeout) * time.Second,
+		SearchPath:      cfg.Server.PluginPath,
+		RequestIDHeader: requestIDs.Header(),
+	}
+	requests := metrics.NewRequests()
+	endpoints := router.New(plugin.NewPool(opener), requests.Handler)
+	applied := make(chan error, 1)
+	go func() {
+		applied <- endpoints.Apply(cfg.Endpoints)
+	}()
+	select {
+	case err := <-applied:
+		if err != nil {
+			endpoints.Close()
+			gologger.Fatalf("Failed to build plugin chain: %v", err)
+		}
+	case sig := <-stop:
+		gologger.Infof("Shutting down due to: %v", sig)
+		endpoints.Close()
+		gologger.Infof("Shutdown complete")
+		return
+	}
+	reloader := NewReloader(*configLocationFlag, endpoints)
+	go reloader.ReloadOnSignal(hangup)
+
+	var adminSrv *http.Server
+	if cfg.Admin != nil {
+		metricsHandler := metrics.Handler(requests, metrics.NewPlugins(endpoints.Endpoints))
+		adminSrv, err = serveAdmin(*cfg.Admin, endpoints, reloader, metricsHandler)
+		if err != nil {
+			endpoints.Close()
+			gologger.Fatalf("Failed to start admin listener due to %q", err.Error())
+		}
+	}
+
+	handler := requestIDs.Handler(tlsconfig.ClientIdentityHandler(endpoints))
 
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	srv := http.Server{
+	srv := &http.Server{
 		Addr:         addr,
 		Handler:      handler,
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 	}
+	srv.TLSConfig = tlsConfig
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			gologger.Infof("Starting HTTPS listener...")
+			serveErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		gologger.Infof("Starting HTTP listener...")
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	gologger.Infof("Starting HTTP listener...")
-	if err = srv.ListenAndServe(); err != nil {
+	select {
+	case err := <-serveErr:
+		endpoints.Close()
 		gologger.Fatalf("HTTP Listener failed with %q", err.Error())
+	case sig := <-stop:
+		gologger.Infof("Shutting down due to: %v", sig)
 	}
-}
 
-type HeaderSticker struct {
-	http.Handler
-	headers map[string]func() string
+	shutdownTimeout := defaultShutdownTimeout
+	if cfg.Server.ShutdownTimeout > 0 {
+		shutdownTimeout = time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+	}
+	if adminSrv != nil {
+		adminSrv.Close()
+	}
+	shutdown(srv, endpoints, shutdownTimeout)
+	gologger.Infof("Shutdown complete")
 }
 
-func NewHeaderSticker(h http.Handler, headers map[string]func() string) *HeaderSticker {
-	return &HeaderSticker{
-		Handler: h,
-		headers: headers,
+// serveAdmin starts serving the admin API on its own listener.
+func serveAdmin(cfg config.AdminConfig, endpoints *router.Router, reloader *Reloader, metrics http.Handler) (*http.Server, error) {
+	listener, err := admin.Listen(cfg)
+	if err != nil {
+		return nil, err
 	}
+	if cfg.Token == "" && cfg.SocketPath == "" {
+		gologger.Warnf("Admin API on %s is not protected by a token", listener.Addr())
+	}
+
+	srv := &http.Server{Handler: admin.NewHandler(endpoints, reloader, metrics, cfg.Token)}
+	go func() {
+		gologger.Infof("Starting admin listener on %s...", listener.Addr())
+		if err := srv.Serve(listener); err != http.ErrServerClosed {
+			gologger.Errorf("Admin listener failed with %q", err.Error())
+		}
+	}()
+	return srv, nil
 }
 
-func (s *HeaderSticker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	for header, valueFunc := range s.headers {
-		value := valueFunc()
-		req.Header.Add(header, value)
-		w.Header().Add(header, value)
+// shutdown stops the listener, waits up to timeout for the in-flight requests
+// to finish and then closes all endpoint plugin chains.
+func shutdown(srv *http.Server, endpoints *router.Router, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		gologger.Warnf("In-flight requests did not finish within %v, closing their connections", timeout)
+		srv.Close()
 	}
-	s.Handler.ServeHTTP(w, req)
+	endpoints.Close()
 }
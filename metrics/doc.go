@@ -0,0 +1,6 @@
+// Package metrics exposes Aker's metrics in the Prometheus text format.
+//
+// Request metrics are recorded per endpoint as requests pass through the
+// router. Plugin metrics are gathered when they are scraped, from the state
+// of the plugin processes and from the /proc file system.
+package metrics
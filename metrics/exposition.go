@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SAP/gologger"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector wraps the basic Collect method.
+type Collector interface {
+	// Collect should write the collector's metric families.
+	Collect(w *Writer)
+}
+
+// Handler returns a http.Handler that exposes the metrics of the specified
+// collectors.
+func Handler(collectors ...Collector) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", ContentType)
+		w := NewWriter(rw)
+		for _, collector := range collectors {
+			collector.Collect(w)
+		}
+		if err := w.Err(); err != nil {
+			gologger.Warnf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+// Writer writes metrics in the Prometheus text format. Write errors are
+// sticky and reported by Err.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Family writes the header of a metric family. All of its samples should
+// follow.
+func (w *Writer) Family(name, kind, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes a single sample. The labels are specified as name and value
+// pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Err returns the first error that occurred while writing.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for index := 0; index+1 < len(labels); index += 2 {
+		pairs = append(pairs, labels[index]+`="`+labelValueEscaper.Replace(labels[index+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,67 @@
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/SAP/aker/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type collectorFunc func(w *Writer)
+
+func (f collectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+var _ = Describe("Writer", func() {
+	var buffer *bytes.Buffer
+	var writer *Writer
+
+	BeforeEach(func() {
+		buffer = new(bytes.Buffer)
+		writer = NewWriter(buffer)
+	})
+
+	It("should write families and samples in the text format", func() {
+		writer.Family("aker_test_total", "counter", "A test counter.")
+		writer.Sample("aker_test_total", 3, "endpoint", "/api/", "code", "2xx")
+		writer.Sample("aker_test_total", 0.5)
+		Ω(writer.Err()).ShouldNot(HaveOccurred())
+		Ω(buffer.String()).Should(Equal(
+			"# HELP aker_test_total A test counter.\n" +
+				"# TYPE aker_test_total counter\n" +
+				`aker_test_total{endpoint="/api/",code="2xx"} 3` + "\n" +
+				"aker_test_total 0.5\n"))
+	})
+
+	It("should escape label values", func() {
+		writer.Sample("aker_test", 1, "path", "a\"b\\c\nd")
+		Ω(buffer.String()).Should(Equal(`aker_test{path="a\"b\\c\nd"} 1` + "\n"))
+	})
+
+	It("should format infinite values", func() {
+		writer.Sample("aker_test", math.Inf(1))
+		Ω(buffer.String()).Should(Equal("aker_test +Inf\n"))
+	})
+})
+
+var _ = Describe("Handler", func() {
+	It("should expose the metrics of all collectors", func() {
+		handler := Handler(
+			collectorFunc(func(w *Writer) { w.Sample("aker_first", 1) }),
+			collectorFunc(func(w *Writer) { w.Sample("aker_second", 2) }),
+		)
+		req, err := http.NewRequest("GET", "http://localhost/metrics", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		Ω(rr.Header().Get("Content-Type")).Should(Equal(ContentType))
+		Ω(rr.Body.String()).Should(Equal("aker_first 1\naker_second 2\n"))
+	})
+})
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/router"
+	"github.com/SAP/gologger"
+)
+
+// Plugins collects the metrics of the plugin processes of the endpoints
+// returned by its source.
+type Plugins struct {
+	endpoints func() []router.EndpointStatus
+}
+
+// NewPlugins returns Plugins which get the endpoints to report on from the
+// specified function, usually Router.Endpoints.
+func NewPlugins(endpoints func() []router.EndpointStatus) *Plugins {
+	return &Plugins{endpoints: endpoints}
+}
+
+// process is a plugin process along with its metric labels.
+type process struct {
+	labels []string
+	status plugin.ReplicaStatus
+	// stats is nil when the process is not running or /proc could not be
+	// read.
+	stats *processStats
+}
+
+// Collect writes the in-flight requests, dial errors, restarts, CPU time and
+// resident memory of each plugin process. A plugin shared by several chain
+// positions is reported once, labeled by its socket rather than by the
+// endpoints using it.
+func (p *Plugins) Collect(w *Writer) {
+	var processes []process
+	seen := make(map[string]bool)
+	for _, endpoint := range p.endpoints() {
+		for _, plug := range endpoint.Plugins {
+			if seen[plug.SocketPath] {
+				continue
+			}
+			seen[plug.SocketPath] = true
+			for index, status := range plug.Replicas {
+				processes = append(processes, newProcess(plug.Name, plug.SocketPath, index, status))
+			}
+		}
+	}
+
+	w.Family("aker_plugin_in_flight_requests", "gauge", "Requests Aker is sending to the plugin process.")
+	for _, proc := range processes {
+		w.Sample("aker_plugin_in_flight_requests", float64(proc.status.InFlight), proc.labels...)
+	}
+	w.Family("aker_plugin_dial_errors_total", "counter", "Failed attempts to connect to the plugin socket.")
+	for _, proc := range processes {
+		w.Sample("aker_plugin_dial_errors_total", float64(proc.status.DialErrors), proc.labels...)
+	}
+	w.Family("aker_plugin_restarts_total", "counter", "Restarts of the plugin process.")
+	for _, proc := range processes {
+		w.Sample("aker_plugin_restarts_total", float64(proc.status.Restarts), proc.labels...)
+	}
+	w.Family("aker_plugin_cpu_seconds_total", "counter", "User and system CPU time of the running plugin process.")
+	for _, proc := range processes {
+		if proc.stats != nil {
+			w.Sample("aker_plugin_cpu_seconds_total", proc.stats.cpuSeconds, proc.labels...)
+		}
+	}
+	w.Family("aker_plugin_resident_memory_bytes", "gauge", "Resident memory of the running plugin process.")
+	for _, proc := range processes {
+		if proc.stats != nil {
+			w.Sample("aker_plugin_resident_memory_bytes", proc.stats.rssBytes, proc.labels...)
+		}
+	}
+}
+
+func newProcess(name, socketPath string, index int, status plugin.ReplicaStatus) process {
+	proc := process{
+		labels: []string{
+			"plugin", name,
+			"socket", socketPath,
+			"replica", strconv.Itoa(index),
+		},
+		status: status,
+	}
+	if status.PID != 0 {
+		stats, err := readProcessStats(status.PID)
+		if err != nil {
+			gologger.Debugf("Failed to read stats of plugin %q (pid %d): %v", name, status.PID, err)
+		} else {
+			proc.stats = &stats
+		}
+	}
+	return proc
+}
@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+
+	"github.com/SAP/aker/endpoint"
+	. "github.com/SAP/aker/metrics"
+	"github.com/SAP/aker/plugin"
+	"github.com/SAP/aker/router"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plugins", func() {
+	var replicas []plugin.ReplicaStatus
+	var output string
+
+	BeforeEach(func() {
+		replicas = []plugin.ReplicaStatus{
+			{PID: os.Getpid(), InFlight: 2, DialErrors: 1, Restarts: 3},
+			{PID: 0, Restarts: 4},
+		}
+	})
+
+	JustBeforeEach(func() {
+		plugins := NewPlugins(func() []router.EndpointStatus {
+			return []router.EndpointStatus{
+				{
+					ID: "/api/",
+					Status: endpoint.Status{
+						Plugins: []endpoint.PluginStatus{
+							{Name: "aker-proxy", SocketPath: "/tmp/aker-plugin-1", Replicas: replicas},
+						},
+					},
+				},
+				{
+					ID: "/web/",
+					Status: endpoint.Status{
+						Plugins: []endpoint.PluginStatus{
+							{Name: "aker-proxy", SocketPath: "/tmp/aker-plugin-1", Replicas: replicas},
+						},
+					},
+				},
+			}
+		})
+		buffer := new(bytes.Buffer)
+		plugins.Collect(NewWriter(buffer))
+		output = buffer.String()
+	})
+
+	It("should report the state of each plugin process", func() {
+		Ω(output).Should(ContainSubstring(`aker_plugin_in_flight_requests{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="0"} 2` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_plugin_dial_errors_total{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="0"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_plugin_restarts_total{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="0"} 3` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_plugin_restarts_total{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="1"} 4` + "\n"))
+	})
+
+	It("should report the processes of shared plugins once", func() {
+		Ω(regexp.MustCompile(`(?m)^aker_plugin_restarts_total\{`).FindAllString(output, -1)).Should(HaveLen(2))
+	})
+
+	It("should report the CPU and memory usage of running processes", func() {
+		Ω(output).Should(MatchRegexp(regexp.QuoteMeta(`aker_plugin_cpu_seconds_total{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="0"} `) + `[0-9.e+-]+\n`))
+		Ω(output).Should(MatchRegexp(regexp.QuoteMeta(`aker_plugin_resident_memory_bytes{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="0"} `) + `[1-9][0-9.e+]*\n`))
+		Ω(output).ShouldNot(ContainSubstring(`aker_plugin_resident_memory_bytes{plugin="aker-proxy",socket="/tmp/aker-plugin-1",replica="1"}`))
+	})
+})
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the number of clock ticks per second used by /proc. It is
+// 100 on all Linux platforms that Go supports.
+const clockTicks = 100
+
+// procRoot is the mount point of the proc file system.
+var procRoot = "/proc"
+
+// processStats describes the resource usage of a process.
+type processStats struct {
+	cpuSeconds float64
+	rssBytes   float64
+}
+
+// readProcessStats reads the CPU time and resident memory of the specified
+// process from /proc/<pid>/stat.
+func readProcessStats(pid int) (processStats, error) {
+	content, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return processStats{}, err
+	}
+	// the command name is in parentheses and may contain spaces
+	stat := string(content)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return processStats{}, fmt.Errorf("malformed stat of process %d", pid)
+	}
+	// fields start with the process state, the third field of the file
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return processStats{}, fmt.Errorf("malformed stat of process %d", pid)
+	}
+
+	var ticks [2]float64
+	for index, field := range fields[11:13] {
+		if ticks[index], err = strconv.ParseFloat(field, 64); err != nil {
+			return processStats{}, err
+		}
+	}
+	rssPages, err := strconv.ParseFloat(fields[21], 64)
+	if err != nil {
+		return processStats{}, err
+	}
+	return processStats{
+		cpuSeconds: (ticks[0] + ticks[1]) / clockTicks,
+		rssBytes:   rssPages * float64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request latency
+// histogram buckets.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Requests records the requests served by each endpoint.
+type Requests struct {
+	buckets []float64
+	now     func() time.Time
+
+	mutex     sync.Mutex
+	endpoints map[string]*endpointRequests
+}
+
+type endpointRequests struct {
+	// counts is indexed by status class, e.g. 2 for 2xx.
+	counts [6]uint64
+	// buckets holds cumulative counts per upper bound.
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewRequests returns Requests that record latencies into DefaultBuckets.
+func NewRequests() *Requests {
+	return &Requests{
+		buckets:   DefaultBuckets,
+		now:       time.Now,
+		endpoints: make(map[string]*endpointRequests),
+	}
+}
+
+// Handler wraps the handler of the specified endpoint, so that the requests
+// it serves are recorded.
+func (r *Requests) Handler(endpoint string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		startedAt := r.now()
+		defer func() {
+			r.observe(endpoint, recorder.status, r.now().Sub(startedAt))
+		}()
+		h.ServeHTTP(recorder, req)
+	})
+}
+
+func (r *Requests) observe(endpoint string, status int, duration time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	class := status / 100
+	if class < 1 || class > 5 {
+		class = 0
+	}
+	seconds := duration.Seconds()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stats, ok := r.endpoints[endpoint]
+	if !ok {
+		stats = &endpointRequests{buckets: make([]uint64, len(r.buckets))}
+		r.endpoints[endpoint] = stats
+	}
+	stats.counts[class]++
+	for index, bound := range r.buckets {
+		if seconds <= bound {
+			stats.buckets[index]++
+		}
+	}
+	stats.sum += seconds
+	stats.count++
+}
+
+// Collect writes the request counts by status class and the latency
+// histograms of all endpoints that served requests so far.
+func (r *Requests) Collect(w *Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	endpoints := make([]string, 0, len(r.endpoints))
+	for endpoint := range r.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	w.Family("aker_requests_total", "counter", "Requests served by endpoint and status class.")
+	for _, endpoint := range endpoints {
+		for class, count := range r.endpoints[endpoint].counts {
+			if count == 0 {
+				continue
+			}
+			w.Sample("aker_requests_total", float64(count), "endpoint", endpoint, "code", statusClass(class))
+		}
+	}
+
+	w.Family("aker_request_duration_seconds", "histogram", "Request latency by endpoint.")
+	for _, endpoint := range endpoints {
+		stats := r.endpoints[endpoint]
+		for index, bound := range r.buckets {
+			w.Sample("aker_request_duration_seconds_bucket", float64(stats.buckets[index]),
+				"endpoint", endpoint, "le", formatValue(bound))
+		}
+		w.Sample("aker_request_duration_seconds_bucket", float64(stats.count), "endpoint", endpoint, "le", "+Inf")
+		w.Sample("aker_request_duration_seconds_sum", stats.sum, "endpoint", endpoint)
+		w.Sample("aker_request_duration_seconds_count", float64(stats.count), "endpoint", endpoint)
+	}
+}
+
+func statusClass(class int) string {
+	if class == 0 {
+		return "other"
+	}
+	return strconv.Itoa(class) + "xx"
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush lets streamed responses through.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
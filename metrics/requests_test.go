@@ -0,0 +1,69 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/SAP/aker/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Requests", func() {
+	var requests *Requests
+
+	serve := func(endpoint string, status int) {
+		handler := requests.Handler(endpoint, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(status)
+		}))
+		req, err := http.NewRequest("GET", "http://localhost/", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	collect := func() string {
+		buffer := new(bytes.Buffer)
+		requests.Collect(NewWriter(buffer))
+		return buffer.String()
+	}
+
+	BeforeEach(func() {
+		requests = NewRequests()
+	})
+
+	It("should count requests by endpoint and status class", func() {
+		serve("/api/", http.StatusOK)
+		serve("/api/", http.StatusCreated)
+		serve("/api/", http.StatusNotFound)
+		serve("/", http.StatusBadGateway)
+
+		output := collect()
+		Ω(output).Should(ContainSubstring(`aker_requests_total{endpoint="/",code="5xx"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_requests_total{endpoint="/api/",code="2xx"} 2` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_requests_total{endpoint="/api/",code="4xx"} 1` + "\n"))
+	})
+
+	It("should record the latency histogram of each endpoint", func() {
+		serve("/api/", http.StatusOK)
+		serve("/api/", http.StatusOK)
+
+		output := collect()
+		Ω(output).Should(ContainSubstring("# TYPE aker_request_duration_seconds histogram\n"))
+		Ω(output).Should(ContainSubstring(`aker_request_duration_seconds_bucket{endpoint="/api/",le="0.005"} 2` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_request_duration_seconds_bucket{endpoint="/api/",le="+Inf"} 2` + "\n"))
+		Ω(output).Should(ContainSubstring(`aker_request_duration_seconds_count{endpoint="/api/"} 2` + "\n"))
+	})
+
+	It("should treat responses without an explicit status as 2xx", func() {
+		handler := requests.Handler("/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		req, err := http.NewRequest("GET", "http://localhost/", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Ω(collect()).Should(ContainSubstring(`aker_requests_total{endpoint="/",code="2xx"} 1` + "\n"))
+	})
+})
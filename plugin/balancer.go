@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// balancer distributes requests across the replicas of a plugin. Replicas
+// which are not ready, e.g. because they are being restarted, are skipped.
+type balancer struct {
+	replicas []*replica
+	strategy LoadBalancing
+	// next is the rotation counter, accessed atomically.
+	next uint64
+}
+
+func newBalancer(replicas []*replica, strategy LoadBalancing) *balancer {
+	return &balancer{
+		replicas: replicas,
+		strategy: strategy,
+	}
+}
+
+func (b *balancer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	replica := b.pick()
+	if replica == nil {
+		http.Error(w, "no plugin replica available", http.StatusServiceUnavailable)
+		return
+	}
+	replica.ServeHTTP(w, req)
+}
+
+// pick returns the replica that should serve the next request, or nil if
+// none is ready.
+func (b *balancer) pick() *replica {
+	count := uint64(len(b.replicas))
+	start := atomic.AddUint64(&b.next, 1)
+
+	var picked *replica
+	var pickedInFlight int64
+	for offset := uint64(0); offset < count; offset++ {
+		candidate := b.replicas[(start+offset)%count]
+		if !candidate.supervisor.isReady() {
+			continue
+		}
+		if b.strategy == RoundRobin {
+			return candidate
+		}
+		inFlight := atomic.LoadInt64(&candidate.inFlight)
+		if picked == nil || inFlight < pickedInFlight {
+			picked, pickedInFlight = candidate, inFlight
+		}
+	}
+	return picked
+}
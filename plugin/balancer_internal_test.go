@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Balancer", func() {
+
+	var replicas []*replica
+	var served []int
+	var strategy LoadBalancing
+
+	newReplica := func(index int, ready bool) *replica {
+		done := make(chan struct{})
+		close(done)
+		r := &readiness{done: done}
+		if !ready {
+			r.err = ExitedBeforeReadyErr
+		}
+		return &replica{
+			handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				served = append(served, index)
+			}),
+			supervisor: &supervisor{
+				process:   &os.Process{},
+				readiness: r,
+			},
+		}
+	}
+
+	serve := func(times int) {
+		b := newBalancer(replicas, strategy)
+		for i := 0; i < times; i++ {
+			req, err := http.NewRequest("GET", "http://aker.me/", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			b.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	BeforeEach(func() {
+		served = nil
+		replicas = []*replica{
+			newReplica(0, true),
+			newReplica(1, true),
+			newReplica(2, true),
+		}
+	})
+
+	Context("when balancing round-robin", func() {
+		BeforeEach(func() {
+			strategy = RoundRobin
+		})
+
+		It("should send requests to the replicas in turn", func() {
+			serve(6)
+			Ω(served).Should(Equal([]int{1, 2, 0, 1, 2, 0}))
+		})
+
+		Context("and a replica is not ready", func() {
+			BeforeEach(func() {
+				replicas[1] = newReplica(1, false)
+			})
+
+			It("should skip it", func() {
+				serve(4)
+				Ω(served).ShouldNot(ContainElement(1))
+				Ω(served).Should(HaveLen(4))
+			})
+		})
+
+		Context("and a replica is not running", func() {
+			BeforeEach(func() {
+				replicas[2].supervisor.process = nil
+			})
+
+			It("should skip it", func() {
+				serve(4)
+				Ω(served).ShouldNot(ContainElement(2))
+			})
+		})
+	})
+
+	Context("when balancing to the least in-flight replica", func() {
+		BeforeEach(func() {
+			strategy = LeastInFlight
+			replicas[0].inFlight = 3
+			replicas[1].inFlight = 1
+			replicas[2].inFlight = 2
+		})
+
+		It("should pick the replica serving the fewest requests", func() {
+			serve(2)
+			Ω(served).Should(Equal([]int{1, 1}))
+		})
+	})
+
+	Context("when no replica is ready", func() {
+		BeforeEach(func() {
+			replicas = []*replica{newReplica(0, false)}
+		})
+
+		It("should respond with service unavailable", func() {
+			b := newBalancer(replicas, RoundRobin)
+			req, err := http.NewRequest("GET", "http://aker.me/", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			rr := httptest.NewRecorder()
+			b.ServeHTTP(rr, req)
+			Ω(rr.Code).Should(Equal(http.StatusServiceUnavailable))
+			Ω(served).Should(BeEmpty())
+		})
+	})
+})
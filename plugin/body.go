@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/SAP/gologger"
+)
+
+// DefaultBodyMemoryLimit is the size of a request body that is usually kept
+// in memory while the body is buffered. Larger bodies spill to disk.
+const DefaultBodyMemoryLimit = 1 << 20
+
+// BodyBuffer configures how a plugin buffers the request body, so that the
+// next plugin of the chain can read it as well.
+type BodyBuffer struct {
+	// MemoryLimit is the number of bytes kept in memory. The rest of the
+	// body is written to a temporary file in SpillDir, which defaults to the
+	// directory for temporary files. MemoryLimit defaults to
+	// DefaultBodyMemoryLimit.
+	MemoryLimit int64
+	SpillDir    string
+	// MaxSize limits the size of the body. Larger requests are rejected with
+	// 413 Request Entity Too Large. Zero means no limit.
+	MaxSize int64
+}
+
+// HeadersOnly returns a http.Handler serving requests with h, which declares
+// that the plugin does not read the request body. The body is then passed on
+// to the next plugin of the chain as it arrives, without being buffered, and
+// h is given an empty body.
+func HeadersOnly(h http.Handler) http.Handler {
+	return &headersOnlyHandler{h}
+}
+
+type headersOnlyHandler struct {
+	http.Handler
+}
+
+func (h *headersOnlyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body := req.Body
+	req.Body = http.NoBody
+	defer func() {
+		req.Body = body
+	}()
+	h.Handler.ServeHTTP(w, req)
+}
+
+// BufferedBody is a request body buffered according to a BodyBuffer, so that
+// it can be read more than once.
+type BufferedBody struct {
+	buffer *bodyBuffer
+}
+
+// BufferBody reads body into a buffer. A *BodyReadError is returned if the
+// body cannot be read, and a BodyTooLargeError if it exceeds the limits.
+func BufferBody(body io.Reader, limits BodyBuffer) (*BufferedBody, error) {
+	buffer, err := bufferBody(body, limits)
+	if err != nil {
+		return nil, err
+	}
+	return &BufferedBody{buffer}, nil
+}
+
+// Reader returns a reader over the whole body, starting from the beginning.
+func (b *BufferedBody) Reader() io.ReadCloser {
+	return b.buffer.reader()
+}
+
+// Close removes the temporary file the body has spilled to, if any.
+func (b *BufferedBody) Close() error {
+	return b.buffer.Close()
+}
+
+// bodyBuffer holds a request body, so that it can be read once per plugin.
+// The start of the body is kept in memory and the rest in a temporary file.
+type bodyBuffer struct {
+	memory []byte
+	file   *os.File
+	size   int64
+}
+
+// bufferBody reads the body into a buffer. A *BodyReadError is returned if
+// the body cannot be read, and a BodyTooLargeError if it exceeds the limit.
+func bufferBody(body io.Reader, limits BodyBuffer) (*bodyBuffer, error) {
+	memoryLimit := limits.MemoryLimit
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultBodyMemoryLimit
+	}
+	if limits.MaxSize > 0 {
+		// reading a byte more than allowed tells whether the body is too large
+		body = io.LimitReader(body, limits.MaxSize+1)
+	}
+
+	var memory bytes.Buffer
+	size, err := memory.ReadFrom(io.LimitReader(body, memoryLimit))
+	if err != nil {
+		return nil, &BodyReadError{err}
+	}
+	buffer := &bodyBuffer{memory: memory.Bytes(), size: size}
+	if size == memoryLimit {
+		if err := buffer.spill(body, limits.SpillDir); err != nil {
+			buffer.Close()
+			return nil, err
+		}
+	}
+	if limits.MaxSize > 0 && buffer.size > limits.MaxSize {
+		buffer.Close()
+		return nil, BodyTooLargeError(limits.MaxSize)
+	}
+	return buffer, nil
+}
+
+// spill writes the remainder of the body to a temporary file.
+func (b *bodyBuffer) spill(body io.Reader, dir string) error {
+	var one [1]byte
+	n, err := io.ReadFull(body, one[:])
+	if n == 0 {
+		if err == io.EOF {
+			return nil
+		}
+		return &BodyReadError{err}
+	}
+
+	if b.file, err = ioutil.TempFile(dir, "aker-body"); err != nil {
+		return err
+	}
+	if _, err := b.file.Write(one[:]); err != nil {
+		return err
+	}
+	size, err := io.Copy(b.file, body)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return err
+		}
+		return &BodyReadError{err}
+	}
+	b.size += 1 + size
+	return nil
+}
+
+// reader returns a reader over the whole body, starting from the beginning.
+func (b *bodyBuffer) reader() io.ReadCloser {
+	var r io.Reader = bytes.NewReader(b.memory)
+	if b.file != nil {
+		fileSize := b.size - int64(len(b.memory))
+		r = io.MultiReader(r, io.NewSectionReader(b.file, 0, fileSize))
+	}
+	return ioutil.NopCloser(r)
+}
+
+// Close removes the temporary file, if any.
+func (b *bodyBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// RejectBody replies to a request whose body could not be buffered, with
+// 413 Request Entity Too Large if the body exceeds the maximum size, with
+// 400 Bad Request if it could not be read, and with 500 Internal Server
+// Error otherwise, which is logged.
+func RejectBody(w http.ResponseWriter, err error, log gologger.Logger) {
+	switch err.(type) {
+	case BodyTooLargeError:
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	case *BodyReadError:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	default:
+		log.Errorf("Error buffering request body: %v\n", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
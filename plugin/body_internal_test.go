@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+var _ = Describe("Body buffer", func() {
+
+	var dir string
+	var limits BodyBuffer
+	var buffer *bodyBuffer
+	var err error
+
+	readAll := func() string {
+		data, err := ioutil.ReadAll(buffer.reader())
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(data)
+	}
+
+	spilled := func() []string {
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		Ω(err).ShouldNot(HaveOccurred())
+		return files
+	}
+
+	BeforeEach(func() {
+		dir, err = ioutil.TempDir("", "aker-body")
+		Ω(err).ShouldNot(HaveOccurred())
+		limits = BodyBuffer{MemoryLimit: 4, SpillDir: dir}
+	})
+
+	AfterEach(func() {
+		if buffer != nil {
+			buffer.Close()
+		}
+		os.RemoveAll(dir)
+	})
+
+	Context("when the body fits into memory", func() {
+		BeforeEach(func() {
+			buffer, err = bufferBody(strings.NewReader("abcd"), limits)
+		})
+
+		It("should keep it in memory", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(spilled()).Should(BeEmpty())
+			Ω(readAll()).Should(Equal("abcd"))
+		})
+	})
+
+	Context("when the body exceeds the memory limit", func() {
+		BeforeEach(func() {
+			buffer, err = bufferBody(strings.NewReader("abcdefghij"), limits)
+		})
+
+		It("should spill the rest to disk", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(spilled()).Should(HaveLen(1))
+			Ω(buffer.size).Should(Equal(int64(10)))
+		})
+
+		It("should return the whole body each time it is read", func() {
+			Ω(readAll()).Should(Equal("abcdefghij"))
+			Ω(readAll()).Should(Equal("abcdefghij"))
+		})
+
+		It("should remove the file when closed", func() {
+			Ω(buffer.Close()).Should(Succeed())
+			Ω(spilled()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the body exceeds the maximum size", func() {
+		BeforeEach(func() {
+			limits.MaxSize = 8
+			buffer, err = bufferBody(strings.NewReader("abcdefghij"), limits)
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(Equal(BodyTooLargeError(8)))
+			Ω(buffer).Should(BeNil())
+		})
+
+		It("should not leave a file behind", func() {
+			Ω(spilled()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the body has the maximum size", func() {
+		BeforeEach(func() {
+			limits.MaxSize = 10
+			buffer, err = bufferBody(strings.NewReader("abcdefghij"), limits)
+		})
+
+		It("should accept it", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readAll()).Should(Equal("abcdefghij"))
+		})
+	})
+
+	Context("when the body cannot be read", func() {
+		BeforeEach(func() {
+			buffer, err = bufferBody(io.MultiReader(strings.NewReader("abcdef"), failingReader{}), limits)
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(Equal(&BodyReadError{errors.New("connection reset")}))
+			Ω(spilled()).Should(BeEmpty())
+		})
+	})
+})
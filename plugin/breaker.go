@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SAP/gologger"
+)
+
+// CircuitOpenHeader is set on the responses rejected because the circuit of
+// a plugin is open. It carries the name of the plugin.
+const CircuitOpenHeader = "X-Aker-Circuit-Open"
+
+// CircuitState is the state of the circuit breaker of a plugin.
+type CircuitState string
+
+const (
+	// CircuitClosed passes requests on to the plugin.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects requests without passing them on.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen passes a limited number of probe requests on, which
+	// decide whether the circuit gets closed or opened again.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// outcome is the result of a request passed through a breaker.
+type outcome int
+
+const (
+	succeeded outcome = iota
+	failed
+	// abandoned requests were canceled by the client and tell nothing about
+	// the health of the plugin.
+	abandoned
+)
+
+// breaker tracks the failures of a plugin and decides whether requests are
+// passed on to it.
+type breaker struct {
+	name    string
+	options CircuitBreaker
+	now     func() time.Time
+
+	mutex sync.Mutex
+	state CircuitState
+	// generation changes with each state transition, so that the outcomes
+	// of requests let through before are ignored.
+	generation  uint64
+	openedAt    time.Time
+	consecutive int
+	// outcomes is a ring of the last Window outcomes while closed, true
+	// meaning failed.
+	outcomes []bool
+	next     int
+	recorded int
+	failures int
+	// probes and successes count the requests let through while half-open.
+	probes    int
+	successes int
+}
+
+func newBreaker(name string, options CircuitBreaker) *breaker {
+	return &breaker{
+		name:     name,
+		options:  options,
+		now:      time.Now,
+		state:    CircuitClosed,
+		outcomes: make([]bool, options.Window),
+	}
+}
+
+// allow reports whether a request may be passed on to the plugin, and
+// returns the generation its outcome has to be recorded with.
+func (b *breaker) allow() (uint64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.expire()
+	switch b.state {
+	case CircuitOpen:
+		return 0, false
+	case CircuitHalfOpen:
+		if b.probes >= b.options.HalfOpenRequests {
+			return 0, false
+		}
+		b.probes++
+	}
+	return b.generation, true
+}
+
+// available reports whether a request would be passed on to the plugin.
+func (b *breaker) available() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.expire()
+	switch b.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return b.probes < b.options.HalfOpenRequests
+	}
+	return true
+}
+
+// current returns the state of the circuit.
+func (b *breaker) current() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.expire()
+	return b.state
+}
+
+// record updates the circuit with the outcome of a request let through in
+// the specified generation.
+func (b *breaker) record(generation uint64, result outcome) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case CircuitHalfOpen:
+		switch result {
+		case failed:
+			b.transition(CircuitOpen)
+		case succeeded:
+			b.successes++
+			if b.successes >= b.options.HalfOpenRequests {
+				b.transition(CircuitClosed)
+			}
+		case abandoned:
+			b.probes--
+		}
+	case CircuitClosed:
+		if result != abandoned {
+			b.count(result == failed)
+		}
+	}
+}
+
+// count adds an outcome to the ones the thresholds are checked against.
+func (b *breaker) count(failure bool) {
+	if failure {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	if b.recorded == len(b.outcomes) {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.recorded++
+	}
+	b.outcomes[b.next] = failure
+	b.next = (b.next + 1) % len(b.outcomes)
+	if failure {
+		b.failures++
+	}
+
+	consecutive := b.options.ConsecutiveFailures > 0 && b.consecutive >= b.options.ConsecutiveFailures
+	rate := b.options.FailureRate > 0 && b.recorded == len(b.outcomes) &&
+		float64(b.failures) >= b.options.FailureRate*float64(len(b.outcomes))
+	if consecutive || rate {
+		b.transition(CircuitOpen)
+	}
+}
+
+// expire lets an open circuit become half-open once its timeout is over.
+func (b *breaker) expire() {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.options.OpenTimeout {
+		b.transition(CircuitHalfOpen)
+	}
+}
+
+func (b *breaker) transition(state CircuitState) {
+	gologger.Infof("Circuit of plugin %q is %s", b.name, state)
+	b.state = state
+	b.generation++
+	switch state {
+	case CircuitOpen:
+		b.openedAt = b.now()
+	case CircuitHalfOpen:
+		b.probes, b.successes = 0, 0
+	case CircuitClosed:
+		b.consecutive, b.next, b.recorded, b.failures = 0, 0, 0, 0
+	}
+}
+
+// breakerHandler passes requests on to the handler of a plugin as long as
+// its circuit allows it.
+type breakerHandler struct {
+	breaker *breaker
+	handler http.Handler
+}
+
+func (h *breakerHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	generation, ok := h.breaker.allow()
+	if !ok {
+		w.Header().Set(CircuitOpenHeader, h.breaker.name)
+		message := fmt.Sprintf("%s: circuit of plugin %q is open", http.StatusText(http.StatusServiceUnavailable), h.breaker.name)
+		http.Error(w, message, http.StatusServiceUnavailable)
+		return
+	}
+
+	failure := false
+	recorder := &statusRecorder{ResponseWriter: w}
+	h.handler.ServeHTTP(recorder, req.WithContext(context.WithValue(req.Context(), failureKey{}, &failure)))
+	switch {
+	case failure || recorder.timedOut(req):
+		h.breaker.record(generation, failed)
+	case req.Context().Err() == context.Canceled:
+		h.breaker.record(generation, abandoned)
+	default:
+		h.breaker.record(generation, succeeded)
+	}
+}
+
+type failureKey struct{}
+
+// reportFailure tells the breaker passing the request on, if any, that
+// the connection to the plugin failed, e.g. because the plugin could not be
+// reached or exited before responding.
+func reportFailure(req *http.Request) {
+	if failure, ok := req.Context().Value(failureKey{}).(*bool); ok {
+		*failure = true
+	}
+}
+
+// statusRecorder records the status of a response and when it started.
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int
+	startedAt time.Time
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.startedAt = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+		w.startedAt = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// timedOut reports whether the plugin did not start responding before the
+// plugin in front of it gave up on the request. Timeouts of later plugins of
+// the chain are replied to in time and do not count against this plugin.
+func (w *statusRecorder) timedOut(req *http.Request) bool {
+	deadline, ok := hopDeadline(req)
+	if !ok {
+		return false
+	}
+	if w.status == 0 {
+		return !time.Now().Before(deadline)
+	}
+	return !w.startedAt.Before(deadline)
+}
@@ -0,0 +1,318 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/SAP/aker/socket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Circuit breaker", func() {
+
+	var options CircuitBreaker
+	var now time.Time
+	var b *breaker
+
+	BeforeEach(func() {
+		options = CircuitBreaker{ConsecutiveFailures: 3}
+		now = time.Unix(1500000000, 0)
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		options, err = options.withDefaults()
+		Ω(err).ShouldNot(HaveOccurred())
+		b = newBreaker("flaky-fox", options)
+		b.now = func() time.Time {
+			return now
+		}
+	})
+
+	serve := func(result outcome) bool {
+		generation, ok := b.allow()
+		if ok {
+			b.record(generation, result)
+		}
+		return ok
+	}
+
+	repeat := func(times int, result outcome) {
+		for i := 0; i < times; i++ {
+			Ω(serve(result)).Should(BeTrue())
+		}
+	}
+
+	It("should reject invalid failure rates", func() {
+		_, err := CircuitBreaker{FailureRate: 1.5}.withDefaults()
+		Ω(err).Should(Equal(InvalidFailureRateError(1.5)))
+	})
+
+	It("should open after consecutive failures", func() {
+		repeat(2, failed)
+		Ω(b.current()).Should(Equal(CircuitClosed))
+		repeat(1, failed)
+		Ω(b.current()).Should(Equal(CircuitOpen))
+		Ω(serve(succeeded)).Should(BeFalse())
+		Ω(b.available()).Should(BeFalse())
+	})
+
+	It("should count failures in a row only", func() {
+		repeat(2, failed)
+		repeat(1, succeeded)
+		repeat(2, failed)
+		Ω(b.current()).Should(Equal(CircuitClosed))
+	})
+
+	It("should ignore the outcome of requests let through before opening", func() {
+		stale, ok := b.allow()
+		Ω(ok).Should(BeTrue())
+		repeat(3, failed)
+		now = now.Add(options.OpenTimeout)
+		Ω(b.current()).Should(Equal(CircuitHalfOpen))
+		b.record(stale, failed)
+		Ω(b.current()).Should(Equal(CircuitHalfOpen))
+	})
+
+	It("should ignore abandoned requests", func() {
+		repeat(5, abandoned)
+		Ω(b.current()).Should(Equal(CircuitClosed))
+	})
+
+	Context("with a failure rate", func() {
+		BeforeEach(func() {
+			options = CircuitBreaker{FailureRate: 0.5, Window: 4}
+		})
+
+		It("should open once the rate is reached in a full window", func() {
+			repeat(1, failed)
+			repeat(1, succeeded)
+			repeat(1, failed)
+			Ω(b.current()).Should(Equal(CircuitClosed))
+			repeat(1, succeeded)
+			Ω(b.current()).Should(Equal(CircuitOpen))
+		})
+
+		It("should only consider the last requests", func() {
+			repeat(1, failed)
+			repeat(4, succeeded)
+			repeat(1, failed)
+			Ω(b.current()).Should(Equal(CircuitClosed))
+		})
+	})
+
+	Context("once the circuit is open", func() {
+		BeforeEach(func() {
+			options.OpenTimeout = time.Minute
+			options.HalfOpenRequests = 2
+		})
+
+		JustBeforeEach(func() {
+			repeat(3, failed)
+		})
+
+		It("should stay open until the timeout is over", func() {
+			now = now.Add(59 * time.Second)
+			Ω(b.current()).Should(Equal(CircuitOpen))
+			now = now.Add(time.Second)
+			Ω(b.current()).Should(Equal(CircuitHalfOpen))
+		})
+
+		Context("and the timeout is over", func() {
+			JustBeforeEach(func() {
+				now = now.Add(time.Minute)
+			})
+
+			It("should let a limited number of probe requests through", func() {
+				_, ok := b.allow()
+				Ω(ok).Should(BeTrue())
+				_, ok = b.allow()
+				Ω(ok).Should(BeTrue())
+				Ω(b.available()).Should(BeFalse())
+				_, ok = b.allow()
+				Ω(ok).Should(BeFalse())
+			})
+
+			It("should close once the probe requests succeed", func() {
+				repeat(2, succeeded)
+				Ω(b.current()).Should(Equal(CircuitClosed))
+				repeat(2, failed)
+				Ω(b.current()).Should(Equal(CircuitClosed))
+			})
+
+			It("should open again if a probe request fails", func() {
+				repeat(1, succeeded)
+				repeat(1, failed)
+				Ω(b.current()).Should(Equal(CircuitOpen))
+			})
+
+			It("should let another probe through if one is abandoned", func() {
+				generation, _ := b.allow()
+				b.allow()
+				b.record(generation, abandoned)
+				Ω(b.available()).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("handler", func() {
+		var status int
+		var header http.Header
+		// broken makes the plugin fail as if its connection had failed, hang
+		// makes it wait for the request to be done.
+		var broken, hang bool
+		var handler http.Handler
+
+		BeforeEach(func() {
+			header = http.Header{}
+			broken, hang = false, false
+		})
+
+		JustBeforeEach(func() {
+			handler = &breakerHandler{
+				breaker: b,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					if broken {
+						reportFailure(req)
+					}
+					if hang {
+						<-req.Context().Done()
+					}
+					for name, values := range header {
+						w.Header()[name] = values
+					}
+					w.WriteHeader(status)
+				}),
+			}
+		})
+
+		serveHTTP := func(ctx context.Context) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		It("should count requests whose connection to the plugin fails as failures", func() {
+			status = http.StatusBadGateway
+			broken = true
+			for i := 0; i < 3; i++ {
+				serveHTTP(context.Background())
+			}
+			Ω(b.current()).Should(Equal(CircuitOpen))
+		})
+
+		It("should count requests the plugin does not respond to in time as failures", func() {
+			status = http.StatusBadGateway
+			hang = true
+			for i := 0; i < 3; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				serveHTTP(ctx)
+				cancel()
+			}
+			Ω(b.current()).Should(Equal(CircuitOpen))
+		})
+
+		It("should count requests the plugin does not respond to before the deadline it was passed", func() {
+			status = http.StatusBadGateway
+			hang = true
+			for i := 0; i < 3; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+				req.Header.Set(DeadlineHeader, time.Now().Add(-hopMargin).Format(time.RFC3339Nano))
+				cancel()
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			Ω(b.current()).Should(Equal(CircuitOpen))
+		})
+
+		It("should not count bad gateways of later plugins or backends as failures", func() {
+			status = http.StatusBadGateway
+			for i := 0; i < 3; i++ {
+				serveHTTP(context.Background())
+			}
+			Ω(b.current()).Should(Equal(CircuitClosed))
+		})
+
+		It("should not count timeouts of later plugins as failures", func() {
+			status = http.StatusGatewayTimeout
+			header.Set(TimedOutHeader, "lazy-dog")
+			for i := 0; i < 3; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				serveHTTP(ctx)
+				cancel()
+			}
+			Ω(b.current()).Should(Equal(CircuitClosed))
+		})
+
+		It("should not count rejections by later plugins as failures", func() {
+			status = http.StatusServiceUnavailable
+			header.Set(CircuitOpenHeader, "lazy-dog")
+			for i := 0; i < 3; i++ {
+				serveHTTP(context.Background())
+			}
+			Ω(b.current()).Should(Equal(CircuitClosed))
+		})
+
+		It("should not count requests canceled by the client", func() {
+			status = http.StatusBadGateway
+			hang = true
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			for i := 0; i < 3; i++ {
+				serveHTTP(ctx)
+			}
+			Ω(b.current()).Should(Equal(CircuitClosed))
+		})
+
+		Context("when the plugin process exits after reading the request", func() {
+			var server *socket.HTTPServer
+			var r *replica
+
+			JustBeforeEach(func() {
+				path, err := socket.GetUniquePath("aker-breaker")
+				Ω(err).ShouldNot(HaveOccurred())
+				server = socket.NewHTTPServer(path, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Ω(err).ShouldNot(HaveOccurred())
+					conn.Close()
+				}))
+				Ω(server.Start()).Should(Succeed())
+
+				r = &replica{socketPath: path}
+				r.handler = socket.ObservedProxyHTTP(path, r.failed)
+				handler = &breakerHandler{breaker: b, handler: r}
+			})
+
+			AfterEach(func() {
+				server.Stop()
+			})
+
+			It("should count the requests as failures", func() {
+				for i := 0; i < 3; i++ {
+					Ω(serveHTTP(context.Background()).Code).Should(Equal(http.StatusBadGateway))
+				}
+				Ω(b.current()).Should(Equal(CircuitOpen))
+				Ω(r.dialErrors).Should(BeZero())
+			})
+		})
+
+		It("should reject requests while open", func() {
+			status = http.StatusBadGateway
+			broken = true
+			for i := 0; i < 3; i++ {
+				serveHTTP(context.Background())
+			}
+
+			status, broken = http.StatusOK, false
+			recorder := serveHTTP(context.Background())
+			Ω(recorder.Code).Should(Equal(http.StatusServiceUnavailable))
+			Ω(recorder.Header().Get(CircuitOpenHeader)).Should(Equal("flaky-fox"))
+			Ω(recorder.Body.String()).Should(ContainSubstring(`circuit of plugin "flaky-fox" is open`))
+		})
+	})
+})
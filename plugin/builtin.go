@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/SAP/gologger"
+)
+
+// builtins holds the factories of the handlers registered to run inside
+// the Aker process.
+var builtins = struct {
+	sync.RWMutex
+	factories map[string]HandlerFactory
+}{factories: make(map[string]HandlerFactory)}
+
+// Register makes the handlers created by factory available to the plugin
+// chains under name. Such a builtin plugin runs inside the Aker process
+// instead of as an executable, and takes precedence over an executable of
+// the same name. The factory is called with the plugin's configuration
+// once per chain position, so that the same factory can be passed to
+// ListenAndServeHTTP to run it as a plugin executable as well.
+//
+// Register is meant to be called from the init function of a package that
+// is compiled into Aker. It panics if name is registered twice.
+func Register(name string, factory HandlerFactory) {
+	builtins.Lock()
+	defer builtins.Unlock()
+	if _, ok := builtins.factories[name]; ok {
+		panic(fmt.Sprintf("plugin: builtin %q registered twice", name))
+	}
+	builtins.factories[name] = factory
+}
+
+// Registered reports whether a builtin plugin is registered under name.
+func Registered(name string) bool {
+	_, ok := builtin(name)
+	return ok
+}
+
+func builtin(name string) (HandlerFactory, bool) {
+	builtins.RLock()
+	defer builtins.RUnlock()
+	factory, ok := builtins.factories[name]
+	return factory, ok
+}
+
+// openBuiltin creates the handler of a builtin plugin and binds it to the
+// next plugin, just like ListenAndServeHTTP does for a plugin executable.
+// The plugin's socket is served by Aker, so that a plugin executable in
+// front of it can forward requests to it. In hub mode, there is no need to.
+func (o *Opener) openBuiltin(name string, factory HandlerFactory, config []byte, next *Plugin, circuit CircuitBreaker, options Options) (*Plugin, error) {
+	if err := options.CheckBuiltin(name); err != nil {
+		return nil, err
+	}
+	handler, err := factory(config)
+	if err != nil {
+		return nil, &BuiltinError{Name: name, Err: err}
+	}
+
+	var nextHandler http.Handler
+	switch {
+	case options.Hub:
+		nextHandler = returnHandler{}
+	case next != nil:
+		nextHandler = TimeoutHandler(next, next.Name(), next.ResponseTimeout(), func(req *http.Request) string {
+			return req.Header.Get(o.RequestIDHeader)
+		})
+	}
+	handler, capabilities := bindHandler(handler, nextHandler, options.Hub, options.BodyBuffer, gologger.DefaultLogger)
+
+	plugin := &Plugin{
+		Handler:         handler,
+		name:            name,
+		responseTimeout: options.ResponseTimeout,
+		hub:             options.Hub,
+		builtin:         true,
+		capabilities:    capabilities,
+	}
+	if circuit.Enabled() {
+		plugin.breaker = newBreaker(name, circuit)
+		plugin.Handler = &breakerHandler{breaker: plugin.breaker, handler: plugin.Handler}
+	}
+	if options.Hub {
+		return plugin, nil
+	}
+	if err := plugin.serveFront(); err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
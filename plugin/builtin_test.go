@@ -0,0 +1,135 @@
+package plugin_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	. "github.com/SAP/aker/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Builtin plugins", func() {
+
+	Register("aker-test-greeter", func(config []byte) (http.Handler, error) {
+		var greeting struct {
+			Header string `yaml:"header"`
+		}
+		if err := UnmarshalConfig(config, &greeting); err != nil {
+			return nil, err
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ioutil.ReadAll(req.Body)
+			req.Header.Set("X-Greeting", greeting.Header)
+		}), nil
+	})
+	Register("aker-test-broken", func([]byte) (http.Handler, error) {
+		return nil, errors.New("out of order")
+	})
+
+	var opener *Opener
+	var next *Plugin
+	var options Options
+	var plug *Plugin
+	var err error
+
+	BeforeEach(func() {
+		opener = &Opener{}
+		next = &Plugin{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			data, _ := ioutil.ReadAll(req.Body)
+			w.Header().Set("X-Greeting", req.Header.Get("X-Greeting"))
+			w.Header().Set("X-Body", string(data))
+			w.WriteHeader(http.StatusAccepted)
+		})}
+		options = Options{}
+	})
+
+	JustBeforeEach(func() {
+		plug, err = opener.Open("aker-test-greeter", []byte("header: hello\n"), next, options)
+	})
+
+	AfterEach(func() {
+		plug.Close()
+	})
+
+	It("should be registered", func() {
+		Ω(Registered("aker-test-greeter")).Should(BeTrue())
+		Ω(Registered("aker-test-missing")).Should(BeFalse())
+	})
+
+	It("should refuse to register a name twice", func() {
+		Ω(func() {
+			Register("aker-test-broken", nil)
+		}).Should(Panic())
+	})
+
+	It("should run inside the process", func() {
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(plug.Builtin()).Should(BeTrue())
+		Ω(plug.Replicas()).Should(BeEmpty())
+		_, err := plug.WaitReady(0)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should pass requests on to the next plugin", func() {
+		recorder := httptest.NewRecorder()
+		plug.ServeHTTP(recorder, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+		Ω(recorder.Code).Should(Equal(http.StatusAccepted))
+		Ω(recorder.Header().Get("X-Greeting")).Should(Equal("hello"))
+		Ω(recorder.Header().Get("X-Body")).Should(Equal("payload"))
+	})
+
+	It("should serve its socket for the plugin in front of it", func() {
+		_, err := os.Stat(plug.SocketPath())
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("in hub mode", func() {
+		BeforeEach(func() {
+			next = nil
+			options.Hub = true
+		})
+
+		It("should return requests to Aker", func() {
+			recorder := httptest.NewRecorder()
+			returned, err := ServeHop(plug, recorder, httptest.NewRequest("GET", "/", nil))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(returned.Header.Get("X-Greeting")).Should(Equal("hello"))
+		})
+
+		It("should support hub mode without a socket", func() {
+			_, err := plug.WaitReady(0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(plug.SocketPath()).Should(BeEmpty())
+		})
+	})
+
+	It("should refuse to be restarted", func() {
+		Ω(plug.Restart()).Should(Equal(BuiltinRestartErr))
+	})
+
+	Context("with process options", func() {
+		It("should reject them", func() {
+			_, err := opener.Open("aker-test-greeter", nil, nil, Options{Replicas: 2})
+			Ω(err).Should(Equal(&BuiltinOptionError{Name: "aker-test-greeter", Option: "replicas"}))
+			_, err = opener.Open("aker-test-greeter", nil, nil, Options{RestartPolicy: RestartPolicy{Mode: RestartAlways}})
+			Ω(err).Should(Equal(&BuiltinOptionError{Name: "aker-test-greeter", Option: "restart_policy"}))
+			_, err = opener.Open("aker-test-greeter", nil, nil, Options{Args: []string{"-v"}})
+			Ω(err).Should(Equal(&BuiltinOptionError{Name: "aker-test-greeter", Option: "args"}))
+			_, err = opener.Open("aker-test-greeter", nil, nil, Options{Env: []string{"GREETING=hello"}})
+			Ω(err).Should(Equal(&BuiltinOptionError{Name: "aker-test-greeter", Option: "env"}))
+		})
+	})
+
+	Context("when the factory fails", func() {
+		It("should return an error naming the plugin", func() {
+			_, err := opener.Open("aker-test-broken", nil, nil, Options{})
+			Ω(err).Should(Equal(&BuiltinError{Name: "aker-test-broken", Err: errors.New("out of order")}))
+		})
+	})
+})
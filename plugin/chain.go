@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+)
+
+// chainKey is the context key of the chainControl of a request.
+type chainKey struct{}
+
+// chainControl records how a plugin wants its request to go on through the
+// chain.
+type chainControl struct {
+	next      func(w http.ResponseWriter, req *http.Request)
+	stopped   bool
+	forwarded bool
+}
+
+func withChainControl(req *http.Request, control *chainControl) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), chainKey{}, control))
+}
+
+func chainControlOf(req *http.Request) *chainControl {
+	control, _ := req.Context().Value(chainKey{}).(*chainControl)
+	return control
+}
+
+// Next passes the request on to the next plugin of the chain right away,
+// with its response written to w. Once the plugin's handler returns, the
+// request does not go on through the chain anymore. Next has no effect at
+// the end of the chain or if it has been called for the request before.
+//
+// The handler must not have written to w before calling Next.
+func Next(w http.ResponseWriter, req *http.Request) {
+	control := chainControlOf(req)
+	if control == nil || control.forwarded {
+		return
+	}
+	control.forwarded = true
+	control.next(w, req)
+}
+
+// Stop ends the chain at the plugin, even if its handler does not write a
+// response. The client then gets an empty 200 OK, unless the handler writes
+// a different response.
+func Stop(req *http.Request) {
+	if control := chainControlOf(req); control != nil {
+		control.stopped = true
+	}
+}
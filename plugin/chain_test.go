@@ -0,0 +1,22 @@
+package plugin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/SAP/aker/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chain control", func() {
+	It("should have no effect outside of a chain", func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		Next(recorder, req)
+		Stop(req)
+		Ω(recorder.Code).Should(Equal(http.StatusOK))
+		Ω(recorder.Body.String()).Should(BeEmpty())
+	})
+})
@@ -1,6 +1,6 @@
 package plugin
 
-import "gopkg.in/yaml.v2"
+import "gopkg.in/yaml.v3"
 
 // UnmarshalConfig parses the plugin configuration data and stores the result
 // in the value pointed by v.
@@ -63,6 +63,21 @@
   to call os.Exit from within a plugin, since this will leave the allocated
   socket file on the file system.
 
+  The same HandlerFactory can be registered with Register from the init
+  function of a package that is compiled into Aker. The plugin then runs
+  inside the Aker process under the registered name, instead of as an
+  executable.
+
+  	func init() {
+  		plugin.Register("my-plugin", myFactory)
+  	}
+
+  Once the plugin is listening on its socket, ListenAndServeHTTP signals
+  Aker that the plugin is ready to serve requests. Aker does not route any
+  requests to an endpoint before all of its plugins are ready, and fails to
+  start the endpoint if some plugin does not become ready in time. Slow
+  initialization should therefore happen in the HandlerFactory.
+
   Plugin's Stdin and Stderr are captured by Aker, so writing to them is the
   way to send log messages to the central Aker log. They'll get decorated by
   appending the plugin name in front of each log line.
@@ -77,6 +92,7 @@
   the value of the X-Aker-Request-Id header for debugging purposes.
   The X-Aker-Request-Id header is also propagated to the end user, so when
   one complains, she is able to provide the header value for tracing.
+  The operator of Aker may configure a different header name.
 
   If a plugin is part of a plugin chain, which means that each request gets
   processed by multiple plugins before it is returned to Aker and thus to the
@@ -84,5 +100,46 @@
   chain is to write something to the response by calling Write or WriteHeader of
   the http.Responsewriter. This will stop the request from going through
   sequential plugins and will return the response to the end user.
+
+  The chain can also be controlled explicitly. Stop ends the chain at the
+  plugin without writing anything, in which case the end user gets an empty
+  200 OK unless the plugin writes a response afterwards. Next passes the
+  request on right away, and lets the plugin act once the rest of the chain
+  has responded. It has to be called before the plugin writes anything, and
+  only the first call has an effect. A plugin that calls neither Stop nor
+  Next nor writes anything has the request passed on once it returns. If
+  the endpoint runs its chain in hub mode, Aker passes requests on from
+  plugin to plugin, and Next returns the request to Aker right away.
+
+  	func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+  		if req.Header.Get("X-Skip") != "" {
+  			plugin.Stop(req)
+  			return
+  		}
+  		plugin.Next(w, req)
+  		log.Printf("served %s", req.URL)
+  	}
+
+  A plugin may read the request body, and the next plugin still gets the
+  whole body, since the body is buffered before it is passed to a plugin
+  that forwards requests. Large bodies spill from memory into a temporary
+  file. A plugin that never reads the body should wrap its handler with
+  HeadersOnly, so that the body is passed on without being buffered.
+
+  	return plugin.HeadersOnly(handler), nil
+
+  A plugin that processes the response of the rest of the chain is written
+  as a Middleware. It is given the handler calling the next plugin, and may
+  pass a ResponseBuffer to it in order to rewrite the response before
+  sending it back.
+
+  	return plugin.Middleware(func(next http.Handler) http.Handler {
+  		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+  			response := &plugin.ResponseBuffer{}
+  			next.ServeHTTP(response, req)
+  			response.Header().Set("X-Checked", "true")
+  			response.Send(w)
+  		})
+  	}), nil
 */
 package plugin
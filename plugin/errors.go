@@ -1,6 +1,10 @@
 package plugin
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 type ConfigDecodeError struct {
 	original error
@@ -9,3 +13,102 @@ type ConfigDecodeError struct {
 func (e *ConfigDecodeError) Error() string {
 	return fmt.Sprintf("error decoding plugin config: %v", e.original.Error())
 }
+
+type UnsupportedRestartModeError string
+
+func (e UnsupportedRestartModeError) Error() string {
+	return fmt.Sprintf("unsupported restart mode: %q", string(e))
+}
+
+type UnsupportedLoadBalancingError string
+
+func (e UnsupportedLoadBalancingError) Error() string {
+	return fmt.Sprintf("unsupported load balancing: %q", string(e))
+}
+
+type InvalidFailureRateError float64
+
+func (e InvalidFailureRateError) Error() string {
+	return fmt.Sprintf("invalid failure rate: %v, must be between 0 and 1", float64(e))
+}
+
+type BodyTooLargeError int64
+
+func (e BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds %d bytes", int64(e))
+}
+
+// BodyReadError is returned when the request body cannot be read.
+type BodyReadError struct {
+	Err error
+}
+
+func (e *BodyReadError) Error() string {
+	return fmt.Sprintf("error reading request body: %v", e.Err)
+}
+
+// ContinuationError is returned when a plugin in hub mode returns a request
+// that cannot be decoded.
+type ContinuationError struct {
+	Err error
+}
+
+func (e *ContinuationError) Error() string {
+	return fmt.Sprintf("invalid request returned by plugin: %v", e.Err)
+}
+
+// BuiltinError is returned when the factory of a builtin plugin fails.
+type BuiltinError struct {
+	Name string
+	Err  error
+}
+
+func (e *BuiltinError) Error() string {
+	return fmt.Sprintf("error creating builtin plugin %q: %v", e.Name, e.Err)
+}
+
+// BuiltinOptionError is returned when a builtin plugin is opened with an
+// option that only applies to plugin processes.
+type BuiltinOptionError struct {
+	Name string
+	// Option is the configuration key of the option.
+	Option string
+}
+
+func (e *BuiltinOptionError) Error() string {
+	return fmt.Sprintf("builtin plugin %q does not support the %q option", e.Name, e.Option)
+}
+
+var BuiltinRestartErr = errors.New("builtin plugins cannot be restarted")
+
+var HubUnsupportedErr = errors.New("plugin does not support the hub chain mode, make sure it is built with a recent plugin package")
+
+var HubMiddlewareErr = errors.New("middleware plugins cannot be part of a chain in hub mode")
+
+var PluginClosedErr = errors.New("plugin is closed")
+
+type IncompatibleProtocolError int
+
+func (e IncompatibleProtocolError) Error() string {
+	return fmt.Sprintf("incompatible protocol version: %d", int(e))
+}
+
+type ReadyTimeoutError time.Duration
+
+func (e ReadyTimeoutError) Error() string {
+	return fmt.Sprintf("no readiness signal within %v, make sure the plugin is built with a recent plugin package",
+		time.Duration(e))
+}
+
+var ExitedBeforeReadyErr = errors.New("plugin exited before signaling readiness")
+
+// NotReadyError is returned when a plugin fails to become ready to serve
+// requests.
+type NotReadyError struct {
+	Name string
+	Err  error
+}
+
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("plugin %q did not become ready: %v", e.Name, e.Err)
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// ProtocolVersion is the version of the protocol spoken between Aker and its
+// plugins.
+const ProtocolVersion = 1
+
+// readyFD is the file descriptor on which a plugin process signals
+// readiness. It is the first of the extra files passed to the process.
+const readyFD = 3
+
+// Capabilities a plugin may report in its Handshake.
+const (
+	// CapabilityForward means that the plugin forwards the requests it does
+	// not handle to the next plugin of the chain.
+	CapabilityForward = "forward"
+	// CapabilityHeadersOnly means that the plugin does not read the request
+	// body, which is passed on to the next plugin without being buffered.
+	CapabilityHeadersOnly = "headers-only"
+	// CapabilityMiddleware means that the plugin calls the next plugin of
+	// the chain itself and processes its response.
+	CapabilityMiddleware = "middleware"
+	// CapabilityHub means that the plugin can return the requests it does
+	// not handle to Aker instead of forwarding them.
+	CapabilityHub = "hub"
+)
+
+// Handshake is sent by a plugin to Aker once it is ready to serve requests.
+type Handshake struct {
+	// ProtocolVersion is the version of the protocol the plugin speaks.
+	ProtocolVersion int `json:"protocol_version"`
+	// Capabilities lists the optional features the plugin supports.
+	Capabilities []string `json:"capabilities"`
+}
+
+// HasCapability reports whether the plugin supports the capability.
+func (h Handshake) HasCapability(capability string) bool {
+	for _, c := range h.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateVersion returns the protocol version used with an Aker process
+// that speaks the specified version.
+func negotiateVersion(akerVersion int) int {
+	if akerVersion > 0 && akerVersion < ProtocolVersion {
+		return akerVersion
+	}
+	return ProtocolVersion
+}
+
+// checkVersion verifies that the version a plugin speaks is supported.
+func checkVersion(version int) error {
+	if version < 1 || version > ProtocolVersion {
+		return IncompatibleProtocolError(version)
+	}
+	return nil
+}
+
+// checkHub verifies that a plugin can be part of a chain in hub mode.
+func checkHub(handshake Handshake) error {
+	if !handshake.HasCapability(CapabilityHub) {
+		return HubUnsupportedErr
+	}
+	if handshake.HasCapability(CapabilityMiddleware) {
+		return HubMiddlewareErr
+	}
+	return nil
+}
+
+// signalReady writes the handshake to the specified file descriptor and then
+// closes it.
+func signalReady(fd int, handshake Handshake) error {
+	file := os.NewFile(uintptr(fd), "aker-ready")
+	defer file.Close()
+	return json.NewEncoder(file).Encode(&handshake)
+}
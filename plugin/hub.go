@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// ContinueHeader is set on the response of a plugin in hub mode that returns
+// a request to Aker, so that Aker passes it on to the next plugin.
+const ContinueHeader = "X-Aker-Continue"
+
+const forwardedForHeader = "X-Forwarded-For"
+
+// continuation is the body of a response returning a request to Aker. It
+// describes the request as the plugin has left it, except for the body,
+// which Aker passes on as it was received.
+type continuation struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Host   string      `json:"host"`
+	Header http.Header `json:"header"`
+	// ResponseHeader holds the response headers the plugin has set without
+	// responding.
+	ResponseHeader http.Header `json:"response_header"`
+}
+
+// returnHandler is the next handler of a plugin in hub mode. It returns the
+// requests to Aker instead of passing them on to the next plugin.
+type returnHandler struct{}
+
+func (returnHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if returning, ok := req.Context().Value(returningKey{}).(*bool); ok {
+		*returning = true
+	}
+	returned := continuation{
+		Method:         req.Method,
+		URL:            req.URL.RequestURI(),
+		Host:           req.Host,
+		Header:         req.Header,
+		ResponseHeader: make(http.Header),
+	}
+	header := w.Header()
+	for name, values := range header {
+		returned.ResponseHeader[name] = values
+		delete(header, name)
+	}
+	header.Set(ContinueHeader, "true")
+	header.Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&returned)
+}
+
+// hubHandler serves the requests of a plugin in hub mode. Only the
+// returnHandler may set the ContinueHeader, so that a response the plugin
+// passes on, e.g. from a backend, is never taken for a returned request.
+type hubHandler struct {
+	handler http.Handler
+}
+
+type returningKey struct{}
+
+func (h *hubHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	returning := false
+	guard := &continueGuard{ResponseWriter: w, returning: &returning}
+	h.handler.ServeHTTP(guard, req.WithContext(context.WithValue(req.Context(), returningKey{}, &returning)))
+}
+
+// continueGuard removes the ContinueHeader from the responses that do not
+// return the request.
+type continueGuard struct {
+	http.ResponseWriter
+	returning *bool
+	started   bool
+}
+
+func (w *continueGuard) WriteHeader(status int) {
+	if !w.started {
+		w.started = true
+		if !*w.returning {
+			w.Header().Del(ContinueHeader)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *continueGuard) Write(data []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *continueGuard) Flush() {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// ServeHop serves req with h, the handler of a plugin opened in hub mode.
+// If the plugin responds, its response is written to w and nil is returned.
+// If the plugin returns the request instead, the response headers it has
+// set are added to w and the request to pass on to the next plugin is
+// returned. The returned request has the context of req and no body.
+//
+// The X-Forwarded-For header of the returned request is the one req arrived
+// with, since the proxy in front of the plugin has added the client to it,
+// and the proxy in front of the next plugin adds the client again.
+//
+// A *ContinuationError is returned if the plugin returns a request that
+// cannot be decoded.
+func ServeHop(h http.Handler, w http.ResponseWriter, req *http.Request) (*http.Request, error) {
+	forwardedFor := append([]string(nil), req.Header[forwardedForHeader]...)
+	hop := &hopWriter{ResponseWriter: w, header: make(http.Header)}
+	h.ServeHTTP(hop, req)
+	if !hop.returned {
+		if !hop.started {
+			addHeader(w.Header(), hop.header)
+		}
+		return nil, nil
+	}
+
+	var returned continuation
+	if err := json.Unmarshal(hop.body.Bytes(), &returned); err != nil {
+		return nil, &ContinuationError{err}
+	}
+	target, err := url.ParseRequestURI(returned.URL)
+	if err != nil {
+		return nil, &ContinuationError{err}
+	}
+	next := req.WithContext(req.Context())
+	next.Method = returned.Method
+	next.URL = target
+	next.Host = returned.Host
+	next.Header = returned.Header
+	if next.Header == nil {
+		next.Header = make(http.Header)
+	}
+	next.Header.Del(forwardedForHeader)
+	if len(forwardedFor) > 0 {
+		next.Header[forwardedForHeader] = forwardedFor
+	}
+	next.Body = http.NoBody
+	addHeader(w.Header(), returned.ResponseHeader)
+	return next, nil
+}
+
+// hopWriter passes the response of a plugin on to the client, unless the
+// plugin returns the request, in which case the response is kept.
+type hopWriter struct {
+	http.ResponseWriter
+	header   http.Header
+	started  bool
+	returned bool
+	body     bytes.Buffer
+}
+
+func (w *hopWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hopWriter) WriteHeader(status int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	if w.header.Get(ContinueHeader) != "" {
+		w.returned = true
+		return
+	}
+	addHeader(w.ResponseWriter.Header(), w.header)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *hopWriter) Write(data []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.returned {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hopWriter) Flush() {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.returned {
+		flusher.Flush()
+	}
+}
+
+// addHeader adds the values of src to dst.
+func addHeader(dst, src http.Header) {
+	for name, values := range src {
+		for _, value := range values {
+			dst.Add(name, value)
+		}
+	}
+}
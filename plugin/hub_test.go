@@ -0,0 +1,110 @@
+package plugin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+
+	. "github.com/SAP/aker/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ServeHop", func() {
+	var handler http.HandlerFunc
+	var recorder *httptest.ResponseRecorder
+	var next *http.Request
+	var err error
+
+	JustBeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		next, err = ServeHop(handler, recorder, httptest.NewRequest("GET", "/", nil))
+	})
+
+	Context("when the plugin returns an invalid request", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set(ContinueHeader, "true")
+				w.Write([]byte("not json"))
+			}
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(BeAssignableToTypeOf(&ContinuationError{}))
+			Ω(next).Should(BeNil())
+		})
+
+		It("should not write a response", func() {
+			Ω(recorder.Header()).Should(BeEmpty())
+			Ω(recorder.Body.Len()).Should(BeZero())
+		})
+	})
+
+	Context("when the plugin does not write anything", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("X-Checked", "true")
+			}
+		})
+
+		It("should keep the headers it has set", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(next).Should(BeNil())
+			Ω(recorder.Header().Get("X-Checked")).Should(Equal("true"))
+		})
+	})
+
+	Context("when plugins behind proxies pass the request on", func() {
+		var plugins []*httptest.Server
+		var forwardedFor [][]string
+		var proxies []http.Handler
+
+		BeforeEach(func() {
+			forwardedFor = nil
+			plugins, proxies = nil, nil
+			for index := 0; index < 3; index++ {
+				plugin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					forwardedFor = append(forwardedFor, req.Header["X-Forwarded-For"])
+					w.Header().Set(ContinueHeader, "true")
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"method": req.Method,
+						"url":    req.URL.RequestURI(),
+						"header": req.Header,
+					})
+				}))
+				target, err := url.Parse(plugin.URL)
+				Ω(err).ShouldNot(HaveOccurred())
+				plugins = append(plugins, plugin)
+				proxies = append(proxies, httputil.NewSingleHostReverseProxy(target))
+			}
+		})
+
+		AfterEach(func() {
+			for _, plugin := range plugins {
+				plugin.Close()
+			}
+		})
+
+		It("should add the client to X-Forwarded-For once for each plugin", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			for _, proxy := range proxies {
+				next, err := ServeHop(proxy, httptest.NewRecorder(), req)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(next).ShouldNot(BeNil())
+				req = next
+			}
+
+			Ω(forwardedFor).Should(Equal([][]string{
+				{"203.0.113.7, 192.0.2.1"},
+				{"203.0.113.7, 192.0.2.1"},
+				{"203.0.113.7, 192.0.2.1"},
+			}))
+			Ω(req.Header["X-Forwarded-For"]).Should(Equal([]string{"203.0.113.7"}))
+		})
+	})
+})
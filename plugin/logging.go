@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sync"
 )
 
 func newLogWriter(name string, sink io.Writer) *logWriter {
@@ -19,6 +20,8 @@ type logWriter struct {
 	name   string
 	sink   io.Writer
 	buffer *bytes.Buffer
+	// tail, if set, keeps the last lines written.
+	tail *lineTail
 }
 
 func (w *logWriter) Write(data []byte) (int, error) {
@@ -28,6 +31,9 @@ func (w *logWriter) Write(data []byte) (int, error) {
 		if err := scanner.Err(); err != nil {
 			return len(data), err
 		}
+		if w.tail != nil {
+			w.tail.add(scanner.Text())
+		}
 		_, err := fmt.Fprintf(w.sink, "[%s]: %s\n", w.name, scanner.Text())
 		if err != nil {
 			return len(data), err
@@ -35,3 +41,30 @@ func (w *logWriter) Write(data []byte) (int, error) {
 	}
 	return len(data), nil
 }
+
+func newLineTail(size int) *lineTail {
+	return &lineTail{size: size}
+}
+
+// lineTail keeps the last lines added to it. It is safe for concurrent use.
+type lineTail struct {
+	mutex sync.Mutex
+	size  int
+	lines []string
+}
+
+func (t *lineTail) add(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.lines) == t.size {
+		t.lines = append(t.lines[:0], t.lines[1:]...)
+	}
+	t.lines = append(t.lines, line)
+}
+
+// Lines returns the kept lines, oldest first.
+func (t *lineTail) Lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.lines...)
+}
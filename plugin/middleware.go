@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/SAP/gologger"
+)
+
+// Middleware returns a http.Handler for a plugin that processes the
+// response of the rest of the chain. The wrap function is given the handler
+// passing requests on to the next plugin, and returns the handler of the
+// plugin, which decides whether and when to call next. A plugin at the end
+// of the chain gets a next handler that responds with an empty 200 OK.
+//
+// To inspect or rewrite the response of the rest of the chain, the plugin
+// passes a ResponseBuffer to next instead of its http.ResponseWriter.
+//
+// The next handler passes on the whole request body, even if the plugin has
+// read it before, unless the plugin is declared HeadersOnly. Then the body
+// is passed on as it arrives and the plugin itself sees an empty body.
+func Middleware(wrap func(next http.Handler) http.Handler) http.Handler {
+	return &middlewareHandler{
+		Handler: wrap(endOfChain),
+		wrap:    wrap,
+	}
+}
+
+// endOfChain is the next handler of a middleware at the end of the chain.
+var endOfChain = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+type middlewareHandler struct {
+	http.Handler
+	wrap func(next http.Handler) http.Handler
+}
+
+// bodyKey is the context key of the function returning the request body to
+// pass on to the next plugin.
+type bodyKey struct{}
+
+// middlewareServer serves a middleware in front of the next plugin.
+type middlewareServer struct {
+	handler     http.Handler
+	headersOnly bool
+	body        BodyBuffer
+	log         gologger.Logger
+}
+
+// bindMiddleware returns the handler serving the middleware with requests
+// passed on to next, which is nil at the end of the chain.
+func bindMiddleware(middleware *middlewareHandler, next http.Handler, headersOnly bool, body BodyBuffer, log gologger.Logger) http.Handler {
+	if next == nil {
+		next = endOfChain
+	}
+	return &middlewareServer{
+		handler:     middleware.wrap(&nextHandler{next}),
+		headersOnly: headersOnly,
+		body:        body,
+		log:         log,
+	}
+}
+
+func (h *middlewareServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var passOn func() io.ReadCloser
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case h.headersOnly:
+		body := req.Body
+		req.Body = http.NoBody
+		passOn = func() io.ReadCloser {
+			return body
+		}
+	default:
+		buffer, err := bufferBody(req.Body, h.body)
+		if err != nil {
+			RejectBody(w, err, h.log)
+			return
+		}
+		defer buffer.Close()
+		req.Body = buffer.reader()
+		passOn = buffer.reader
+	}
+	if passOn != nil {
+		req = req.WithContext(context.WithValue(req.Context(), bodyKey{}, passOn))
+	}
+	h.handler.ServeHTTP(w, req)
+}
+
+// nextHandler passes requests on to the next plugin along with the request
+// body as it was received.
+type nextHandler struct {
+	next http.Handler
+}
+
+func (h *nextHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if passOn, ok := req.Context().Value(bodyKey{}).(func() io.ReadCloser); ok {
+		req.Body = passOn()
+	}
+	h.next.ServeHTTP(w, req)
+}
+
+// ResponseBuffer is a http.ResponseWriter holding a response, so that a
+// middleware can inspect and rewrite the response of the rest of the chain
+// before sending it with Send. The zero value is ready to use.
+type ResponseBuffer struct {
+	// StatusCode is zero until the response is written to, and defaults to
+	// 200 OK when sent.
+	StatusCode int
+	Body       bytes.Buffer
+	header     http.Header
+}
+
+// Header returns the header of the response.
+func (b *ResponseBuffer) Header() http.Header {
+	if b.header == nil {
+		b.header = make(http.Header)
+	}
+	return b.header
+}
+
+// WriteHeader records the status code, unless one is recorded already.
+func (b *ResponseBuffer) WriteHeader(status int) {
+	if b.StatusCode == 0 {
+		b.StatusCode = status
+	}
+}
+
+// Write appends the data to the body.
+func (b *ResponseBuffer) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.Body.Write(data)
+}
+
+// Send sends the response to w. The Content-Length header is set to the
+// length of the body.
+func (b *ResponseBuffer) Send(w http.ResponseWriter) error {
+	header := w.Header()
+	for name, values := range b.Header() {
+		header[name] = values
+	}
+	header.Set("Content-Length", strconv.Itoa(b.Body.Len()))
+	status := b.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, err := w.Write(b.Body.Bytes())
+	return err
+}
@@ -0,0 +1,68 @@
+package plugin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/SAP/aker/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Middleware", func() {
+	It("should call the end of the chain when served on its own", func() {
+		handler := Middleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				response := &ResponseBuffer{}
+				next.ServeHTTP(response, req)
+				response.Header().Set("X-Served-By", "middleware")
+				Ω(response.Send(w)).Should(Succeed())
+			})
+		})
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		Ω(recorder.Code).Should(Equal(http.StatusOK))
+		Ω(recorder.Header().Get("X-Served-By")).Should(Equal("middleware"))
+		Ω(recorder.Body.String()).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("ResponseBuffer", func() {
+	var buffer *ResponseBuffer
+
+	BeforeEach(func() {
+		buffer = &ResponseBuffer{}
+	})
+
+	It("should record the first status code", func() {
+		buffer.WriteHeader(http.StatusNotFound)
+		buffer.WriteHeader(http.StatusOK)
+		Ω(buffer.StatusCode).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should record 200 OK when written to", func() {
+		buffer.Write([]byte("hello"))
+		Ω(buffer.StatusCode).Should(Equal(http.StatusOK))
+		Ω(buffer.Body.String()).Should(Equal("hello"))
+	})
+
+	It("should send the rewritten response", func() {
+		buffer.Header().Set("Content-Length", "5")
+		buffer.Header().Set("Content-Type", "text/plain")
+		buffer.Write([]byte("hello"))
+
+		buffer.StatusCode = http.StatusAccepted
+		buffer.Body.Reset()
+		buffer.Body.WriteString(strings.ToUpper("hello, world"))
+
+		recorder := httptest.NewRecorder()
+		Ω(buffer.Send(recorder)).Should(Succeed())
+		Ω(recorder.Code).Should(Equal(http.StatusAccepted))
+		Ω(recorder.Header().Get("Content-Type")).Should(Equal("text/plain"))
+		Ω(recorder.Header().Get("Content-Length")).Should(Equal("12"))
+		Ω(recorder.Body.String()).Should(Equal("HELLO, WORLD"))
+	})
+})
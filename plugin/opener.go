@@ -3,16 +3,20 @@ package plugin
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/SAP/aker/socket"
 )
 
 // Open opens the specified plugin using the DefaultOpener.
-func Open(name string, config []byte, next *Plugin) (*Plugin, error) {
-	return DefaultOpener.Open(name, config, next)
+func Open(name string, config []byte, next *Plugin, options Options) (*Plugin, error) {
+	return DefaultOpener.Open(name, config, next, options)
 }
 
 // DefaultOpener redirects the plugin's stdout and stderr to the calling process's
@@ -28,9 +32,105 @@ type Opener struct {
 	PluginStdout io.Writer
 	// Stderr of the child process is redirected to PluginStderr.
 	PluginStderr io.Writer
+	// StopTimeout is the time the plugin is given to exit once it is closed.
+	// If zero, DefaultStopTimeout is used.
+	StopTimeout time.Duration
+	// SearchPath lists directories that are searched for plugin executables
+	// before the ones in the PATH environment variable.
+	SearchPath []string
+	// RequestIDHeader is the header carrying the ID of each request. Plugins
+	// include it when they report that the next plugin timed out.
+	RequestIDHeader string
 }
 
-func (o *Opener) Open(name string, config []byte, next *Plugin) (*Plugin, error) {
+// Open starts the plugin executable and supervises it according to the
+// restart policy in options. The plugin forwards requests it does not handle
+// to next, if specified.
+//
+// If options specify more than one replica, each replica is started on its
+// own socket and the returned plugin balances requests across them. The
+// plugin's socket is then served by Aker itself, so that the previous plugin
+// of a chain gets balanced as well. The same applies to plugins with a
+// circuit breaker, so that the breaker sees all of their requests.
+//
+// A plugin registered with Register runs inside the Aker process instead,
+// and the process options do not apply to it.
+func (o *Opener) Open(name string, config []byte, next *Plugin, options Options) (*Plugin, error) {
+	policy, err := options.RestartPolicy.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := options.LoadBalancing.withDefault()
+	if err != nil {
+		return nil, err
+	}
+	circuit, err := options.CircuitBreaker.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if factory, ok := builtin(name); ok {
+		return o.openBuiltin(name, factory, config, next, circuit, options)
+	}
+	executable, err := o.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	count := options.Replicas
+	if count < 1 {
+		count = 1
+	}
+
+	plugin := &Plugin{name: name, responseTimeout: options.ResponseTimeout, hub: options.Hub}
+	for index := 0; index < count; index++ {
+		replicaName := name
+		if count > 1 {
+			replicaName = fmt.Sprintf("%s#%d", name, index+1)
+		}
+		replica, err := o.startReplica(replicaName, executable, config, next, policy, options)
+		if err != nil {
+			plugin.Close()
+			return nil, err
+		}
+		plugin.replicas = append(plugin.replicas, replica)
+	}
+
+	if count == 1 {
+		plugin.Handler = plugin.replicas[0]
+	} else {
+		plugin.Handler = newBalancer(plugin.replicas, strategy)
+	}
+	if circuit.Enabled() {
+		plugin.breaker = newBreaker(name, circuit)
+		plugin.Handler = &breakerHandler{breaker: plugin.breaker, handler: plugin.Handler}
+	}
+	if count == 1 && plugin.breaker == nil {
+		plugin.socketPath = plugin.replicas[0].socketPath
+		return plugin, nil
+	}
+
+	if err := plugin.serveFront(); err != nil {
+		plugin.Close()
+		return nil, err
+	}
+	return plugin, nil
+}
+
+// LookPath returns the path of the executable of the named plugin. Names
+// without a slash are searched for in the SearchPath first and in the
+// directories of the PATH environment variable second.
+func (o *Opener) LookPath(name string) (string, error) {
+	if !strings.Contains(name, "/") {
+		for _, dir := range o.SearchPath {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				return path, nil
+			}
+		}
+	}
+	return exec.LookPath(name)
+}
+
+func (o *Opener) startReplica(name, executable string, config []byte, next *Plugin, policy RestartPolicy, options Options) (*replica, error) {
 	socketPath, err := socket.GetUniquePath("aker-plugin")
 	if err != nil {
 		return nil, err
@@ -40,22 +140,60 @@ func (o *Opener) Open(name string, config []byte, next *Plugin) (*Plugin, error)
 		SocketPath:        socketPath,
 		ForwardSocketPath: next.SocketPath(),
 		Configuration:     config,
+		ProtocolVersion:   ProtocolVersion,
+		ReadyFD:           readyFD,
+		ForwardPlugin:     next.Name(),
+		ForwardTimeout:    next.ResponseTimeout(),
+		RequestIDHeader:   o.RequestIDHeader,
+		BodyMemoryLimit:   options.BodyBuffer.MemoryLimit,
+		BodySpillDir:      options.BodyBuffer.SpillDir,
+		BodyMaxSize:       options.BodyBuffer.MaxSize,
+		Hub:               options.Hub,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := exec.Command(name)
-	cmd.Stdin = bytes.NewReader(setup)
-	cmd.Stdout = newLogWriter(name, o.PluginStdout)
-	cmd.Stderr = newLogWriter(name, o.PluginStderr)
-	if err := cmd.Start(); err != nil {
+	var supervisor *supervisor
+	supervisor = newSupervisor(name, socketPath, policy, o.stopTimeout(), func() *exec.Cmd {
+		stderr := newLogWriter(name, o.PluginStderr)
+		stderr.tail = supervisor.stderr
+
+		cmd := command(executable, options)
+		cmd.Stdin = bytes.NewReader(setup)
+		cmd.Stdout = newLogWriter(name, o.PluginStdout)
+		cmd.Stderr = stderr
+		return cmd
+	})
+	if err := supervisor.start(); err != nil {
 		return nil, err
 	}
 
-	return &Plugin{
+	replica := &replica{
 		socketPath: socketPath,
-		Handler:    socket.ProxyHTTP(socketPath),
-		process:    cmd.Process,
-	}, nil
+		supervisor: supervisor,
+	}
+	replica.handler = socket.ObservedProxyHTTP(socketPath, replica.failed)
+	return replica, nil
+}
+
+// command prepares the command running the plugin executable with the
+// process options.
+func command(executable string, options Options) *exec.Cmd {
+	cmd := exec.Command(executable, options.Args...)
+	cmd.Dir = options.Dir
+	switch {
+	case options.CleanEnv:
+		cmd.Env = append([]string{}, options.Env...)
+	case len(options.Env) > 0:
+		cmd.Env = append(os.Environ(), options.Env...)
+	}
+	return cmd
+}
+
+func (o *Opener) stopTimeout() time.Duration {
+	if o.StopTimeout == 0 {
+		return DefaultStopTimeout
+	}
+	return o.StopTimeout
 }
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Opener", func() {
+	Describe("LookPath", func() {
+		var dir string
+		var opener *Opener
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "aker-opener")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ioutil.WriteFile(filepath.Join(dir, "aker-plugin"), []byte("#!/bin/sh\n"), 0755)).Should(Succeed())
+			Ω(ioutil.WriteFile(filepath.Join(dir, "sh"), []byte("#!/bin/sh\n"), 0644)).Should(Succeed())
+			opener = &Opener{SearchPath: []string{filepath.Join(dir, "missing"), dir}}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should find executables in the search path", func() {
+			Ω(opener.LookPath("aker-plugin")).Should(Equal(filepath.Join(dir, "aker-plugin")))
+		})
+
+		It("should skip files that are not executable", func() {
+			path, err := opener.LookPath("sh")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(path).ShouldNot(Equal(filepath.Join(dir, "sh")))
+		})
+
+		It("should not search for paths", func() {
+			_, err := opener.LookPath("./aker-plugin")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should fail for unknown executables", func() {
+			_, err := opener.LookPath("aker-no-such-plugin")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("command", func() {
+		BeforeEach(func() {
+			os.Setenv("AKER_TEST_INHERITED", "yes")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("AKER_TEST_INHERITED")
+		})
+
+		It("should pass the arguments and the working directory", func() {
+			cmd := command("/bin/plugin", Options{Args: []string{"-v", "--port=0"}, Dir: "/srv"})
+			Ω(cmd.Args).Should(Equal([]string{"/bin/plugin", "-v", "--port=0"}))
+			Ω(cmd.Dir).Should(Equal("/srv"))
+		})
+
+		It("should inherit the environment of Aker by default", func() {
+			cmd := command("/bin/plugin", Options{})
+			Ω(cmd.Env).Should(BeNil())
+		})
+
+		It("should add variables to the environment of Aker", func() {
+			cmd := command("/bin/plugin", Options{Env: []string{"TOKEN=secret"}})
+			Ω(cmd.Env).Should(ContainElement("AKER_TEST_INHERITED=yes"))
+			Ω(cmd.Env[len(cmd.Env)-1]).Should(Equal("TOKEN=secret"))
+		})
+
+		It("should replace the environment of Aker when asked to", func() {
+			cmd := command("/bin/plugin", Options{Env: []string{"TOKEN=secret"}, CleanEnv: true})
+			Ω(cmd.Env).Should(Equal([]string{"TOKEN=secret"}))
+		})
+
+		It("should start with an empty environment when asked to", func() {
+			cmd := command("/bin/plugin", Options{CleanEnv: true})
+			Ω(cmd.Env).ShouldNot(BeNil())
+			Ω(cmd.Env).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,211 @@
+package plugin
+
+import "time"
+
+// Default restart backoff values, used when a RestartPolicy does not specify
+// them.
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultMaxRestartBackoff = time.Minute
+)
+
+// RestartMode determines when a plugin process gets restarted.
+type RestartMode string
+
+const (
+	// RestartOnFailure restarts the plugin if it exits with non-zero status
+	// or gets killed by a signal.
+	RestartOnFailure RestartMode = "on-failure"
+	// RestartAlways restarts the plugin whenever it exits.
+	RestartAlways RestartMode = "always"
+	// RestartNever leaves the plugin down once it exits.
+	RestartNever RestartMode = "never"
+)
+
+// RestartPolicy configures the supervision of a plugin process.
+type RestartPolicy struct {
+	// Mode defaults to RestartOnFailure.
+	Mode RestartMode
+	// MaxRestarts limits the number of consecutive restarts. Once the limit
+	// is reached the plugin is left down. Zero means no limit.
+	MaxRestarts int
+	// Backoff is the delay before the first restart. It doubles with each
+	// consecutive restart, up to MaxBackoff. A plugin that stays up for
+	// MaxBackoff is considered recovered and the backoff is reset.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// LoadBalancing determines how requests are distributed across the replicas
+// of a plugin.
+type LoadBalancing string
+
+const (
+	// RoundRobin sends requests to the replicas in turn.
+	RoundRobin LoadBalancing = "round-robin"
+	// LeastInFlight sends requests to the replica which is currently serving
+	// the fewest requests.
+	LeastInFlight LoadBalancing = "least-in-flight"
+)
+
+// Default circuit breaker values, used when a CircuitBreaker does not
+// specify them.
+const (
+	DefaultBreakerWindow      = 20
+	DefaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// CircuitBreaker configures when the requests for a failing plugin are
+// rejected right away instead of being passed on to it. A request fails if
+// the plugin cannot be reached or does not respond in time. The breaker is
+// disabled unless one of the thresholds is set.
+type CircuitBreaker struct {
+	// ConsecutiveFailures opens the circuit once as many requests in a row
+	// have failed.
+	ConsecutiveFailures int
+	// FailureRate opens the circuit once the share of failed requests among
+	// the last Window requests reaches it. It is between zero and one.
+	// Window defaults to DefaultBreakerWindow.
+	FailureRate float64
+	Window      int
+	// OpenTimeout is the time the circuit stays open before probe requests
+	// are let through. It defaults to DefaultBreakerOpenTimeout.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe requests that have to succeed
+	// in order to close the circuit again. It defaults to one.
+	HalfOpenRequests int
+}
+
+// Enabled reports whether any threshold of the breaker is set.
+func (b CircuitBreaker) Enabled() bool {
+	return b.ConsecutiveFailures > 0 || b.FailureRate > 0
+}
+
+// Options configures how a plugin process is run.
+type Options struct {
+	RestartPolicy RestartPolicy
+	// Replicas is the number of plugin processes to start. Values lower than
+	// one mean a single process.
+	Replicas int
+	// LoadBalancing defaults to RoundRobin.
+	LoadBalancing LoadBalancing
+	// Args are passed to the plugin executable on its command line.
+	Args []string
+	// Env holds "KEY=value" entries that are added to the environment of
+	// Aker, or replace it if CleanEnv is set.
+	Env      []string
+	CleanEnv bool
+	// Dir is the working directory of the plugin. If empty, the plugin runs
+	// in the working directory of Aker.
+	Dir string
+	// ResponseTimeout is the time the plugin is given to start responding
+	// to a request passed to it. Zero means no limit.
+	ResponseTimeout time.Duration
+	CircuitBreaker  CircuitBreaker
+	// BodyBuffer applies to plugins forwarding requests to a next plugin.
+	BodyBuffer BodyBuffer
+	// Hub makes the plugin return the requests it does not respond to to
+	// Aker, which passes them on to the next plugin, instead of forwarding
+	// them itself.
+	Hub bool
+}
+
+// Validate checks that the restart mode and the load balancing are
+// supported, and that the circuit breaker thresholds are valid.
+func (o Options) Validate() error {
+	if _, err := o.RestartPolicy.withDefaults(); err != nil {
+		return err
+	}
+	if _, err := o.LoadBalancing.withDefault(); err != nil {
+		return err
+	}
+	_, err := o.CircuitBreaker.withDefaults()
+	return err
+}
+
+// CheckBuiltin returns a *BuiltinOptionError naming the first option that
+// only applies to plugin processes, if any, so that the named builtin
+// plugin cannot be opened with options it would ignore.
+func (o Options) CheckBuiltin(name string) error {
+	var option string
+	switch {
+	case o.Replicas > 1:
+		option = "replicas"
+	case o.LoadBalancing != "":
+		option = "load_balancing"
+	case o.RestartPolicy != RestartPolicy{}:
+		option = "restart_policy"
+	case len(o.Args) > 0:
+		option = "args"
+	case len(o.Env) > 0:
+		option = "env"
+	case o.CleanEnv:
+		option = "clean_env"
+	case o.Dir != "":
+		option = "dir"
+	default:
+		return nil
+	}
+	return &BuiltinOptionError{Name: name, Option: option}
+}
+
+func (b CircuitBreaker) withDefaults() (CircuitBreaker, error) {
+	if b.FailureRate < 0 || b.FailureRate > 1 {
+		return b, InvalidFailureRateError(b.FailureRate)
+	}
+	if b.Window <= 0 {
+		b.Window = DefaultBreakerWindow
+	}
+	if b.OpenTimeout <= 0 {
+		b.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if b.HalfOpenRequests <= 0 {
+		b.HalfOpenRequests = 1
+	}
+	return b, nil
+}
+
+func (b LoadBalancing) withDefault() (LoadBalancing, error) {
+	switch b {
+	case "":
+		return RoundRobin, nil
+	case RoundRobin, LeastInFlight:
+		return b, nil
+	}
+	return b, UnsupportedLoadBalancingError(b)
+}
+
+func (p RestartPolicy) withDefaults() (RestartPolicy, error) {
+	switch p.Mode {
+	case "":
+		p.Mode = RestartOnFailure
+	case RestartOnFailure, RestartAlways, RestartNever:
+	default:
+		return p, UnsupportedRestartModeError(p.Mode)
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultRestartBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxRestartBackoff
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	return p, nil
+}
+
+// shouldRestart reports whether a process that exited successfully or not,
+// after the specified number of consecutive restarts, should be restarted.
+func (p RestartPolicy) shouldRestart(success bool, restarts int) bool {
+	if p.MaxRestarts > 0 && restarts >= p.MaxRestarts {
+		return false
+	}
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return !success
+	}
+	return false
+}
@@ -1,15 +1,89 @@
 package plugin
 
 import (
+	"errors"
 	"net/http"
-	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SAP/aker/socket"
 )
 
+// DefaultStopTimeout is the time a plugin is given to exit after being
+// interrupted, before it gets killed.
+const DefaultStopTimeout = 10 * time.Second
+
+// DefaultReadyTimeout is the time a plugin is usually given to signal that
+// it is ready to serve requests.
+const DefaultReadyTimeout = 10 * time.Second
+
+// restartPollInterval is how often a restarted replica is checked for
+// readiness.
+const restartPollInterval = 10 * time.Millisecond
+
 // Plugin represents an Aker plugin.
 type Plugin struct {
 	http.Handler
+	name       string
 	socketPath string
-	process    *os.Process
+	// responseTimeout is the time the plugin is given to start responding.
+	responseTimeout time.Duration
+	replicas        []*replica
+	// front serves the plugin's socket when requests are balanced across
+	// multiple replicas.
+	front *socket.HTTPServer
+	// breaker is nil unless the plugin has a circuit breaker.
+	breaker *breaker
+	// hub is set if the plugin returns requests to Aker.
+	hub bool
+	// builtin is set if the plugin runs inside the Aker process, which has
+	// no handshake to report its capabilities.
+	builtin      bool
+	capabilities []string
+	// release and users are set by the Pool the plugin is shared by.
+	release func() error
+	users   func() int
+}
+
+// Name returns the name the plugin was opened with.
+func (p *Plugin) Name() string {
+	if p == nil {
+		return ""
+	}
+	return p.name
+}
+
+// ResponseTimeout returns the time the plugin is given to start responding
+// to a request, or zero if there is no limit.
+func (p *Plugin) ResponseTimeout() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.responseTimeout
+}
+
+// Circuit returns the state of the plugin's circuit breaker, or an empty
+// state if the plugin has none.
+func (p *Plugin) Circuit() CircuitState {
+	if p == nil || p.breaker == nil {
+		return ""
+	}
+	return p.breaker.current()
+}
+
+// Available reports whether the plugin's circuit breaker, if any, would
+// pass a request on to the plugin.
+func (p *Plugin) Available() bool {
+	if p == nil || p.breaker == nil {
+		return true
+	}
+	return p.breaker.available()
+}
+
+// Builtin reports whether the plugin runs inside the Aker process.
+func (p *Plugin) Builtin() bool {
+	return p != nil && p.builtin
 }
 
 // SocketPath returns the path of the socket that the plugin is binded to.
@@ -20,17 +94,213 @@ func (p *Plugin) SocketPath() string {
 	return p.socketPath
 }
 
+// WaitReady waits for all replicas of the plugin to signal that they are
+// ready to serve requests and returns the handshake the first one sent.
+// A *NotReadyError is returned if some replica does not become ready within
+// timeout, exits before that, or speaks an incompatible protocol. The same
+// applies if the plugin is opened in hub mode, but is a middleware or does
+// not support it. A builtin plugin is ready right away.
+func (p *Plugin) WaitReady(timeout time.Duration) (Handshake, error) {
+	handshake := Handshake{ProtocolVersion: ProtocolVersion}
+	if p == nil {
+		return handshake, nil
+	}
+	handshake.Capabilities = p.capabilities
+	deadline := time.Now().Add(timeout)
+	for index, replica := range p.replicas {
+		replicaHandshake, err := replica.supervisor.waitReady(time.Until(deadline))
+		if err != nil {
+			return Handshake{}, &NotReadyError{Name: p.name, Err: err}
+		}
+		if index == 0 {
+			handshake = replicaHandshake
+		}
+	}
+	if p.hub {
+		if err := checkHub(handshake); err != nil {
+			return Handshake{}, &NotReadyError{Name: p.name, Err: err}
+		}
+	}
+	return handshake, nil
+}
+
+// ReplicaStatus describes the state of a single plugin process.
+type ReplicaStatus struct {
+	// PID is zero while the process is not running.
+	PID        int
+	SocketPath string
+	StartedAt  time.Time
+	Restarts   int
+	Ready      bool
+	// InFlight is the number of requests Aker is sending to the process.
+	InFlight int
+	// DialErrors is the number of times Aker failed to connect to the
+	// process.
+	DialErrors int
+}
+
+// Replicas returns the state of each of the plugin's processes.
+func (p *Plugin) Replicas() []ReplicaStatus {
+	if p == nil {
+		return nil
+	}
+	statuses := make([]ReplicaStatus, len(p.replicas))
+	for index, r := range p.replicas {
+		statuses[index] = r.supervisor.status()
+		statuses[index].Ready = r.supervisor.isReady()
+		statuses[index].InFlight = int(atomic.LoadInt64(&r.inFlight))
+		statuses[index].DialErrors = int(atomic.LoadInt64(&r.dialErrors))
+	}
+	return statuses
+}
+
+// Users returns the number of chain positions the plugin is opened at.
+// Only plugins shared through a Pool have more than one.
+func (p *Plugin) Users() int {
+	if p == nil || p.users == nil {
+		return 1
+	}
+	return p.users()
+}
+
+// Restart stops the plugin processes and starts them again. Replicas are
+// restarted one at a time and each of them is given DefaultReadyTimeout to
+// become ready before the next one is restarted, so that the plugin keeps
+// serving requests in the meantime. Builtin plugins have no processes, and
+// BuiltinRestartErr is returned for them.
+func (p *Plugin) Restart() error {
+	if p == nil {
+		return nil
+	}
+	if p.builtin {
+		return BuiltinRestartErr
+	}
+	for index, r := range p.replicas {
+		if err := r.supervisor.restart(); err != nil {
+			return err
+		}
+		if index == len(p.replicas)-1 {
+			break
+		}
+		deadline := time.Now().Add(DefaultReadyTimeout)
+		for !r.supervisor.isReady() {
+			if time.Now().After(deadline) {
+				return &NotReadyError{Name: p.name, Err: ReadyTimeoutError(DefaultReadyTimeout)}
+			}
+			time.Sleep(restartPollInterval)
+		}
+	}
+	return nil
+}
+
+// serveFront serves the plugin's socket with its handler.
+func (p *Plugin) serveFront() error {
+	var err error
+	if p.socketPath, err = socket.GetUniquePath("aker-plugin"); err != nil {
+		return err
+	}
+	front := socket.NewHTTPServer(p.socketPath, p.Handler)
+	if err := front.Start(); err != nil {
+		return err
+	}
+	p.front = front
+	return nil
+}
+
 // Close releases all resources allocated by the plugin.
+//
+// The plugin processes stop being supervised and are interrupted and given
+// time to finish serving their requests. If they do not exit in time, they
+// get killed. Either way, the plugin's socket files are removed from the
+// file system.
+//
+// A plugin opened by a Pool is shared, so it keeps running until all of its
+// users have closed it.
 func (p *Plugin) Close() error {
-	if err := p.process.Signal(os.Interrupt); err != nil {
-		return err
+	if p == nil {
+		return nil
+	}
+	if p.release != nil {
+		return p.release()
+	}
+	return p.close()
+}
+
+func (p *Plugin) close() error {
+	var firstErr error
+	if p.front != nil {
+		firstErr = p.front.Stop()
+	}
+
+	errs := make([]error, len(p.replicas))
+	var group sync.WaitGroup
+	for index, r := range p.replicas {
+		group.Add(1)
+		go func(index int, r *replica) {
+			defer group.Done()
+			errs[index] = r.supervisor.close()
+		}(index, r)
+	}
+	group.Wait()
+
+	for _, err := range errs {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// replica is a single process of a plugin.
+type replica struct {
+	socketPath string
+	handler    http.Handler
+	supervisor *supervisor
+	// inFlight is the number of requests being served, accessed atomically.
+	inFlight int64
+	// dialErrors is the number of failed connection attempts, accessed
+	// atomically.
+	dialErrors int64
+}
+
+func (r *replica) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt64(&r.inFlight, 1)
+	defer atomic.AddInt64(&r.inFlight, -1)
+	r.handler.ServeHTTP(w, req)
+}
+
+// failed is called by the proxy of the replica with each request whose
+// connection to the plugin process fails. The failure counts against the
+// circuit breaker of the plugin, if any.
+func (r *replica) failed(req *http.Request, err error) {
+	var dial *socket.DialError
+	if errors.As(err, &dial) {
+		atomic.AddInt64(&r.dialErrors, 1)
 	}
-	_, err := p.process.Wait()
-	return err
+	reportFailure(req)
 }
 
 type setup struct {
 	SocketPath        string `json:"socket_path"`
 	ForwardSocketPath string `json:"forward_socket_path"`
 	Configuration     []byte `json:"configuration"`
+	// ProtocolVersion is the version of the protocol Aker speaks.
+	ProtocolVersion int `json:"protocol_version"`
+	// ReadyFD is the file descriptor on which the plugin should send its
+	// Handshake once it is ready. Zero means that Aker does not expect one.
+	ReadyFD int `json:"ready_fd"`
+	// ForwardPlugin is the name of the next plugin and ForwardTimeout the
+	// time it is given to start responding. Zero means no limit.
+	ForwardPlugin  string        `json:"forward_plugin"`
+	ForwardTimeout time.Duration `json:"forward_timeout"`
+	// RequestIDHeader is the header carrying the ID of each request.
+	RequestIDHeader string `json:"request_id_header"`
+	// Hub is set if the plugin should return the requests it does not
+	// respond to to Aker.
+	Hub bool `json:"hub"`
+	// The request body is buffered according to these fields before it is
+	// passed on to the next plugin.
+	BodyMemoryLimit int64  `json:"body_memory_limit"`
+	BodySpillDir    string `json:"body_spill_dir"`
+	BodyMaxSize     int64  `json:"body_max_size"`
 }
@@ -1,6 +1,8 @@
 package plugin_test
 
 import (
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -18,11 +20,13 @@ var _ = Describe("Open Plugin", func() {
 
 	var pluginName string
 	var config []byte
+	var options Options
 
 	var plugin *Plugin
 	var err error
 
 	BeforeEach(func() {
+		options = Options{}
 		buildCmd := exec.Command("go", "build", "-o", buildedPluginName, "test_plugin/main.go")
 		buildCmd.Stdout = os.Stdout
 		buildCmd.Stderr = os.Stderr
@@ -39,7 +43,7 @@ var _ = Describe("Open Plugin", func() {
 			PluginStdout: GinkgoWriter,
 			PluginStderr: GinkgoWriter,
 		}
-		plugin, err = opener.Open("./"+pluginName, config, nil)
+		plugin, err = opener.Open("./"+pluginName, config, nil, options)
 	})
 
 	Context("when the plugin does not exist", func() {
@@ -53,6 +57,26 @@ var _ = Describe("Open Plugin", func() {
 		})
 	})
 
+	Context("when the plugin exits without signaling readiness", func() {
+		BeforeEach(func() {
+			pluginName = "not_ready.sh"
+			Ω(ioutil.WriteFile(pluginName, []byte("#!/bin/sh\nexit 0\n"), 0755)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Ω(plugin.Close()).Should(Succeed())
+		})
+
+		It("should fail waiting for readiness", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err := plugin.WaitReady(5 * time.Second)
+			Ω(err).Should(Equal(&NotReadyError{
+				Name: "./" + pluginName,
+				Err:  ExitedBeforeReadyErr,
+			}))
+		})
+	})
+
 	Context("when the plugin exists", func() {
 		BeforeEach(func() {
 			pluginName = buildedPluginName
@@ -71,6 +95,13 @@ var _ = Describe("Open Plugin", func() {
 			time.Sleep(time.Millisecond * 20)
 		})
 
+		It("should become ready", func() {
+			handshake, err := plugin.WaitReady(5 * time.Second)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(handshake.ProtocolVersion).Should(Equal(ProtocolVersion))
+			Ω(handshake.HasCapability(CapabilityForward)).Should(BeTrue())
+		})
+
 		It("should receive the correct configuration", func() {
 			rr := httptest.NewRecorder()
 			req, err := http.NewRequest("GET", "http://does.not.matter.com", nil)
@@ -79,6 +110,52 @@ var _ = Describe("Open Plugin", func() {
 			Ω(rr.Body.Bytes()).Should(Equal(config))
 		})
 
+		Context("and multiple replicas are requested", func() {
+			BeforeEach(func() {
+				options.Replicas = 3
+			})
+
+			It("should become ready", func() {
+				_, err := plugin.WaitReady(5 * time.Second)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should serve requests through its socket", func() {
+				_, err := plugin.WaitReady(5 * time.Second)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				for i := 0; i < 3; i++ {
+					resp, err := socketHTTPClient(plugin.SocketPath()).Get("http://does.not.matter.com")
+					Ω(err).ShouldNot(HaveOccurred())
+					body, err := ioutil.ReadAll(resp.Body)
+					resp.Body.Close()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(body).Should(Equal(config))
+				}
+			})
+		})
+
+		Context("and is then closed", func() {
+			It("should remove the plugin socket file", func() {
+				Ω(plugin.Close()).Should(Succeed())
+				_, err := os.Stat(plugin.SocketPath())
+				Ω(os.IsNotExist(err)).Should(BeTrue())
+			})
+
+			It("should be safe to close it again", func() {
+				Ω(plugin.Close()).Should(Succeed())
+			})
+		})
 	})
 
 })
+
+func socketHTTPClient(path string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.Dial("unix", path)
+			},
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+)
+
+type opener interface {
+	Open(name string, config []byte, next *Plugin, options Options) (*Plugin, error)
+}
+
+// Pool shares plugins between the chains that open them with the same
+// configuration and options, and in front of the same next plugin. Since
+// a plugin forwards requests to a fixed next plugin, chains can only share
+// the plugins that all the following plugins are shared with as well.
+type Pool struct {
+	opener opener
+
+	mutex   sync.Mutex
+	plugins map[poolKey]*pooled
+}
+
+type poolKey struct {
+	name    string
+	config  string
+	options string
+	next    *Plugin
+}
+
+type pooled struct {
+	plugin *Plugin
+	users  int
+	// opened is closed once the plugin is opened, or err is set.
+	opened chan struct{}
+	err    error
+}
+
+// NewPool returns a Pool that opens plugins using the provided opener.
+func NewPool(o opener) *Pool {
+	return &Pool{
+		opener:  o,
+		plugins: make(map[poolKey]*pooled),
+	}
+}
+
+// Open returns the plugin opened with the same arguments before, if it is
+// still in use, and opens the plugin otherwise. Either way, the returned
+// plugin has to be closed once it is not needed anymore. Plugins with
+// different arguments are opened concurrently, while an Open with the same
+// arguments waits for the plugin being opened.
+func (p *Pool) Open(name string, config []byte, next *Plugin, options Options) (*Plugin, error) {
+	key := poolKey{
+		name:    name,
+		config:  string(config),
+		options: fmt.Sprintf("%+v", options),
+		next:    next,
+	}
+
+	p.mutex.Lock()
+	if entry, ok := p.plugins[key]; ok {
+		entry.users++
+		p.mutex.Unlock()
+		<-entry.opened
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return entry.plugin, nil
+	}
+	// reserve the key, so that the plugin is opened only once, without
+	// holding up the chains opening other plugins
+	entry := &pooled{users: 1, opened: make(chan struct{})}
+	p.plugins[key] = entry
+	p.mutex.Unlock()
+	defer close(entry.opened)
+
+	plug, err := p.opener.Open(name, config, next, options)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil {
+		delete(p.plugins, key)
+		entry.err = err
+		return nil, err
+	}
+	plug.release = func() error {
+		return p.release(key, plug)
+	}
+	plug.users = func() int {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return entry.users
+	}
+	entry.plugin = plug
+	return plug, nil
+}
+
+func (p *Pool) release(key poolKey, plug *Plugin) error {
+	p.mutex.Lock()
+	entry, ok := p.plugins[key]
+	if !ok || entry.plugin != plug {
+		p.mutex.Unlock()
+		return PluginClosedErr
+	}
+	entry.users--
+	if entry.users > 0 {
+		p.mutex.Unlock()
+		return nil
+	}
+	delete(p.plugins, key)
+	p.mutex.Unlock()
+	return entry.plugin.close()
+}
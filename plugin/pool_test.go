@@ -0,0 +1,141 @@
+package plugin_test
+
+import (
+	"errors"
+	"sync"
+
+	. "github.com/SAP/aker/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type countingOpener struct {
+	opened int
+	err    error
+}
+
+func (o *countingOpener) Open(name string, config []byte, next *Plugin, options Options) (*Plugin, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	o.opened++
+	return &Plugin{}, nil
+}
+
+// blockingOpener blocks opening the plugins named "slow" until unblocked.
+type blockingOpener struct {
+	mutex   sync.Mutex
+	opened  map[string]int
+	unblock chan struct{}
+}
+
+func (o *blockingOpener) Open(name string, config []byte, next *Plugin, options Options) (*Plugin, error) {
+	o.mutex.Lock()
+	o.opened[name]++
+	o.mutex.Unlock()
+	if name == "slow" {
+		<-o.unblock
+	}
+	return &Plugin{}, nil
+}
+
+func (o *blockingOpener) count(name string) int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.opened[name]
+}
+
+var _ = Describe("Pool", func() {
+	var opener *countingOpener
+	var pool *Pool
+
+	BeforeEach(func() {
+		opener = &countingOpener{}
+		pool = NewPool(opener)
+	})
+
+	It("should share plugins opened with the same arguments", func() {
+		first, err := pool.Open("auth", []byte("realm: aker"), nil, Options{Replicas: 2})
+		Ω(err).ShouldNot(HaveOccurred())
+		second, err := pool.Open("auth", []byte("realm: aker"), nil, Options{Replicas: 2})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(second).Should(BeIdenticalTo(first))
+		Ω(opener.opened).Should(Equal(1))
+	})
+
+	It("should open plugins with different arguments separately", func() {
+		next, _ := pool.Open("proxy", nil, nil, Options{})
+		first, _ := pool.Open("auth", []byte("realm: aker"), nil, Options{})
+		pool.Open("auth", []byte("realm: other"), nil, Options{})
+		pool.Open("auth", []byte("realm: aker"), nil, Options{Replicas: 2})
+		pool.Open("auth", []byte("realm: aker"), next, Options{})
+		pool.Open("other", []byte("realm: aker"), nil, Options{})
+		Ω(opener.opened).Should(Equal(6))
+		Ω(first.Close()).Should(Succeed())
+	})
+
+	It("should keep shared plugins open until all users closed them", func() {
+		first, _ := pool.Open("auth", nil, nil, Options{})
+		pool.Open("auth", nil, nil, Options{})
+		Ω(first.Close()).Should(Succeed())
+
+		third, _ := pool.Open("auth", nil, nil, Options{})
+		Ω(third).Should(BeIdenticalTo(first))
+		Ω(opener.opened).Should(Equal(1))
+
+		Ω(first.Close()).Should(Succeed())
+		Ω(first.Close()).Should(Succeed())
+		Ω(first.Close()).Should(Equal(PluginClosedErr))
+
+		pool.Open("auth", nil, nil, Options{})
+		Ω(opener.opened).Should(Equal(2))
+	})
+
+	It("should count the users of shared plugins", func() {
+		first, _ := pool.Open("auth", nil, nil, Options{})
+		Ω(first.Users()).Should(Equal(1))
+		pool.Open("auth", nil, nil, Options{})
+		Ω(first.Users()).Should(Equal(2))
+		Ω(first.Close()).Should(Succeed())
+		Ω(first.Users()).Should(Equal(1))
+	})
+
+	Context("when a plugin takes long to open", func() {
+		var blocking *blockingOpener
+
+		BeforeEach(func() {
+			blocking = &blockingOpener{opened: make(map[string]int), unblock: make(chan struct{})}
+			pool = NewPool(blocking)
+		})
+
+		It("should open other plugins in the meantime", func() {
+			opened := make(chan *Plugin, 2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					defer GinkgoRecover()
+					plug, err := pool.Open("slow", nil, nil, Options{})
+					Ω(err).ShouldNot(HaveOccurred())
+					opened <- plug
+				}()
+			}
+			Eventually(func() int { return blocking.count("slow") }).Should(Equal(1))
+
+			_, err := pool.Open("fast", nil, nil, Options{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Consistently(opened).ShouldNot(Receive())
+
+			close(blocking.unblock)
+			first, second := <-opened, <-opened
+			Ω(second).Should(BeIdenticalTo(first))
+			Ω(blocking.count("slow")).Should(Equal(1))
+			Ω(first.Users()).Should(Equal(2))
+		})
+	})
+
+	It("should return the errors of the opener", func() {
+		opener.err = errors.New("no such plugin")
+		_, err := pool.Open("auth", nil, nil, Options{})
+		Ω(err).Should(Equal(opener.err))
+	})
+})
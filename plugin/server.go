@@ -102,12 +102,12 @@ func (s *Server) ListenAndServeHTTP(factory HandlerFactory) error {
 	if err != nil {
 		return err
 	}
-	if setup.ForwardSocketPath != "" {
-		handler = &forwardHandler{
-			current: handler,
-			next:    s.socket.ProxyHTTP(setup.ForwardSocketPath),
-		}
-	}
+	handler, capabilities := s.bind(handler, setup)
+
+	// the signals are handled before Aker learns that the plugin is ready,
+	// so that the plugin stops cleanly even if Aker stops it right away
+	c := make(chan os.Signal, 1)
+	s.signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	s.log.Infof("Listening on socket: %s\n", setup.SocketPath)
 
@@ -117,14 +117,84 @@ func (s *Server) ListenAndServeHTTP(factory HandlerFactory) error {
 	}
 	defer server.Stop()
 
-	c := make(chan os.Signal)
-	s.signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	if setup.ReadyFD != 0 {
+		handshake := Handshake{
+			ProtocolVersion: negotiateVersion(setup.ProtocolVersion),
+			Capabilities:    capabilities,
+		}
+		if err := signalReady(setup.ReadyFD, handshake); err != nil {
+			s.log.Errorf("Error signaling readiness: %v\n", err)
+		}
+	}
 
 	sig := <-c
 	s.log.Infof("Exiting due to: %v\n", sig)
 	return nil
 }
 
+// bind returns the handler serving the plugin's socket, which passes the
+// requests on to the next plugin as needed, or returns them to Aker in hub
+// mode, along with the capabilities of the plugin.
+func (s *Server) bind(handler http.Handler, setup setup) (http.Handler, []string) {
+	body := BodyBuffer{
+		MemoryLimit: setup.BodyMemoryLimit,
+		SpillDir:    setup.BodySpillDir,
+		MaxSize:     setup.BodyMaxSize,
+	}
+
+	var next http.Handler
+	switch {
+	case setup.Hub:
+		next = returnHandler{}
+	case setup.ForwardSocketPath != "":
+		// the deadline of the request applies even without a timeout
+		next = TimeoutHandler(s.socket.ProxyHTTP(setup.ForwardSocketPath), setup.ForwardPlugin, setup.ForwardTimeout, func(req *http.Request) string {
+			return req.Header.Get(setup.RequestIDHeader)
+		})
+	}
+	return bindHandler(handler, next, setup.Hub, body, s.log)
+}
+
+// bindHandler returns the handler of a plugin that passes the requests on to
+// next as needed, along with the capabilities of the plugin. Next is nil at
+// the end of the chain, and returns the requests to Aker in hub mode. The
+// deadline a request arrives with applies to the plugin and to next.
+func bindHandler(handler, next http.Handler, hub bool, body BodyBuffer, log gologger.Logger) (http.Handler, []string) {
+	handler, capabilities := chainHandler(handler, next, hub, body, log)
+	if hub {
+		handler = &hubHandler{handler: handler}
+	}
+	return withDeadline(handler), capabilities
+}
+
+func chainHandler(handler, next http.Handler, hub bool, body BodyBuffer, log gologger.Logger) (http.Handler, []string) {
+	capabilities := []string{CapabilityForward, CapabilityHub}
+	headersOnly, ok := handler.(*headersOnlyHandler)
+	if ok {
+		capabilities = append(capabilities, CapabilityHeadersOnly)
+	}
+
+	middleware, isMiddleware := handler.(*middlewareHandler)
+	if headersOnly != nil {
+		middleware, isMiddleware = headersOnly.Handler.(*middlewareHandler)
+	}
+	if isMiddleware {
+		capabilities = append(capabilities, CapabilityMiddleware)
+		return bindMiddleware(middleware, next, headersOnly != nil, body, log), capabilities
+	}
+	if next == nil {
+		return handler, capabilities
+	}
+	// in hub mode, Aker passes the body on to the next plugin itself
+	return &forwardHandler{
+		current: handler,
+		next:    next,
+		replay:  headersOnly == nil && !hub,
+		body:    body,
+		log:     log,
+	}, capabilities
+}
+
 // ListenAndServeHTTP calls ListenAndServeHTTP of the DefaultServer.
 func ListenAndServeHTTP(factory HandlerFactory) error {
 	return DefaultServer.ListenAndServeHTTP(factory)
@@ -145,19 +215,52 @@ func (w *responseTracker) WriteHeader(status int) {
 	w.ResponseWriter.WriteHeader(status)
 }
 
+// forwardHandler passes the requests that the current plugin does not
+// respond to on to the next plugin, unless the plugin stops the chain or
+// calls the next plugin itself. If replay is set, the request body is
+// buffered, so that the next plugin gets the whole body even if the current
+// plugin has read it.
 type forwardHandler struct {
 	current http.Handler
 	next    http.Handler
+	replay  bool
+	body    BodyBuffer
+	log     gologger.Logger
 }
 
 func (h *forwardHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	body := req.Body
+	passOn := func() io.ReadCloser {
+		return body
+	}
+	if h.replay && req.Body != nil && req.Body != http.NoBody {
+		buffer, err := bufferBody(req.Body, h.body)
+		if err != nil {
+			RejectBody(resp, err, h.log)
+			return
+		}
+		defer buffer.Close()
+		req.Body = buffer.reader()
+		passOn = buffer.reader
+	}
+
+	control := &chainControl{
+		next: func(w http.ResponseWriter, req *http.Request) {
+			req.Body = passOn()
+			h.next.ServeHTTP(w, req)
+		},
+	}
 	respTracker := &responseTracker{
 		ResponseWriter: resp,
 		done:           false,
 	}
+	// the request the plugin has seen is passed on, including the fields
+	// the plugin has changed
+	req = withChainControl(req, control)
 	h.current.ServeHTTP(respTracker, req)
-	if respTracker.done {
+	if respTracker.done || control.forwarded || control.stopped {
 		return
 	}
-	h.next.ServeHTTP(resp, req)
+	control.forwarded = true
+	control.next(resp, req)
 }
@@ -2,10 +2,17 @@ package plugin_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	. "github.com/SAP/aker/plugin"
 	"github.com/SAP/aker/plugin/pluginfakes"
@@ -75,13 +82,17 @@ var _ = Describe("ListenAndServeHTTP", func() {
 
 			var socketPath string
 			var handler http.Handler
+			var served *http.Request
 			var httpServer *pluginfakes.FakeHTTPServer
 
 			BeforeEach(func() {
 				socketPath = "/tmp/aker.sock"
 				config = buildConfig(socketPath, "")
 
-				handler = http.NewServeMux() // we do not care what this is, as long as it is not nil
+				served = nil
+				handler = http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+					served = req
+				})
 				factory = func(_ []byte) (http.Handler, error) {
 					return handler, nil
 				}
@@ -98,15 +109,107 @@ var _ = Describe("ListenAndServeHTTP", func() {
 				Ω(fakeSocket.NewHTTPServerCallCount()).Should(Equal(1))
 				argSocketPath, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
 				Ω(argSocketPath).Should(Equal(socketPath))
-				Ω(argHandler).Should(Equal(handler))
+				argHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+				Ω(served).ShouldNot(BeNil())
 
 				Ω(httpServer.StartCallCount()).Should(Equal(1))
 			})
 
+			It("should apply the deadline a request arrives with to its context", func() {
+				_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+				deadline := time.Now().Add(time.Minute).Round(time.Millisecond)
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Set(DeadlineHeader, deadline.Format(time.RFC3339Nano))
+				argHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+				Ω(served.Header.Get(DeadlineHeader)).Should(BeEmpty())
+				servedDeadline, ok := served.Context().Deadline()
+				Ω(ok).Should(BeTrue())
+				Ω(servedDeadline).Should(BeTemporally("==", deadline))
+			})
+
 			It("should stop the HTTP server when signaled", func() {
 				Ω(httpServer.StopCallCount()).Should(Equal(1))
 			})
 
+			Context("and a signal arrives while the HTTP server starts", func() {
+				var startedBeforeNotify int
+
+				BeforeEach(func() {
+					startedBeforeNotify = -1
+					fakeNotifier.NotifyStub = func(c chan<- os.Signal, sig ...os.Signal) {
+						startedBeforeNotify = httpServer.StartCallCount()
+						c <- syscall.SIGTERM
+					}
+				})
+
+				It("should handle it once the server has started", func() {
+					Ω(startedBeforeNotify).Should(BeZero())
+					Ω(httpServer.StartCallCount()).Should(Equal(1))
+					Ω(httpServer.StopCallCount()).Should(Equal(1))
+				})
+			})
+
+			Context("and the config specifies a ready file descriptor", func() {
+				var readyReader *os.File
+
+				BeforeEach(func() {
+					var readyWriter *os.File
+					var err error
+					readyReader, readyWriter, err = os.Pipe()
+					Ω(err).ShouldNot(HaveOccurred())
+					// the server closes the descriptor it is given, so hand it a copy
+					fd, err := syscall.Dup(int(readyWriter.Fd()))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(readyWriter.Close()).Should(Succeed())
+
+					config = []byte(fmt.Sprintf(`{"socket_path":"%s","protocol_version":1,"ready_fd":%d}`, socketPath, fd))
+				})
+
+				AfterEach(func() {
+					readyReader.Close()
+				})
+
+				It("should send a handshake once the HTTP server is started", func() {
+					var handshake Handshake
+					Ω(json.NewDecoder(readyReader).Decode(&handshake)).Should(Succeed())
+					Ω(handshake).Should(Equal(Handshake{
+						ProtocolVersion: ProtocolVersion,
+						Capabilities:    []string{CapabilityForward, CapabilityHub},
+					}))
+				})
+
+				Context("and the plugin only needs headers", func() {
+					BeforeEach(func() {
+						factory = func(_ []byte) (http.Handler, error) {
+							return HeadersOnly(handler), nil
+						}
+					})
+
+					It("should report the capability in the handshake", func() {
+						var handshake Handshake
+						Ω(json.NewDecoder(readyReader).Decode(&handshake)).Should(Succeed())
+						Ω(handshake.HasCapability(CapabilityHeadersOnly)).Should(BeTrue())
+					})
+				})
+
+				Context("and the plugin is a middleware", func() {
+					BeforeEach(func() {
+						factory = func(_ []byte) (http.Handler, error) {
+							return Middleware(func(next http.Handler) http.Handler {
+								return next
+							}), nil
+						}
+					})
+
+					It("should report the capability in the handshake", func() {
+						var handshake Handshake
+						Ω(json.NewDecoder(readyReader).Decode(&handshake)).Should(Succeed())
+						Ω(handshake.HasCapability(CapabilityMiddleware)).Should(BeTrue())
+					})
+				})
+			})
+
 			Context("and the config has empty ForwardSocketPath field", func() {
 				It("should not call socket.ProxyHTTP", func() {
 					Ω(fakeSocket.ProxyHTTPCallCount()).Should(BeZero())
@@ -127,6 +230,367 @@ var _ = Describe("ListenAndServeHTTP", func() {
 					path := fakeSocket.ProxyHTTPArgsForCall(0)
 					Ω(path).Should(Equal(forwardSocketPath))
 				})
+
+				Context("and a plugin reading the request body", func() {
+					var read, forwarded string
+
+					BeforeEach(func() {
+						read, forwarded = "", ""
+						handler = http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+							data, _ := ioutil.ReadAll(req.Body)
+							read = string(data)
+						})
+						fakeSocket.ProxyHTTPReturns(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+							data, _ := ioutil.ReadAll(req.Body)
+							forwarded = string(data)
+						}))
+					})
+
+					serve := func() {
+						_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+						req := httptest.NewRequest("POST", "/", strings.NewReader("signed payload"))
+						argHandler.ServeHTTP(httptest.NewRecorder(), req)
+					}
+
+					It("should pass the whole body on to the next plugin", func() {
+						serve()
+						Ω(read).Should(Equal("signed payload"))
+						Ω(forwarded).Should(Equal("signed payload"))
+					})
+
+					Context("which is limited", func() {
+						BeforeEach(func() {
+							config = []byte(fmt.Sprintf(`{"forward_socket_path":"%s","body_max_size":4}`, forwardSocketPath))
+						})
+
+						It("should reject larger bodies", func() {
+							_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+							req := httptest.NewRequest("POST", "/", strings.NewReader("signed payload"))
+							recorder := httptest.NewRecorder()
+							argHandler.ServeHTTP(recorder, req)
+							Ω(recorder.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+							Ω(read).Should(BeEmpty())
+							Ω(forwarded).Should(BeEmpty())
+						})
+					})
+
+					Context("but declaring that it only needs headers", func() {
+						BeforeEach(func() {
+							handler = HeadersOnly(handler)
+						})
+
+						It("should not give the plugin the body", func() {
+							serve()
+							Ω(read).Should(BeEmpty())
+							Ω(forwarded).Should(Equal("signed payload"))
+						})
+					})
+				})
+
+				Context("and a plugin controlling the chain explicitly", func() {
+					var forwarded int
+					var control func(w http.ResponseWriter, req *http.Request)
+
+					BeforeEach(func() {
+						forwarded = 0
+						fakeSocket.ProxyHTTPReturns(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							forwarded++
+							data, _ := ioutil.ReadAll(req.Body)
+							w.Header().Set("X-Forwarded-Body", string(data))
+							w.WriteHeader(http.StatusAccepted)
+						}))
+						handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							control(w, req)
+						})
+					})
+
+					serve := func() *httptest.ResponseRecorder {
+						_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+						req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+						recorder := httptest.NewRecorder()
+						argHandler.ServeHTTP(recorder, req)
+						return recorder
+					}
+
+					It("should end the chain when the plugin stops it", func() {
+						control = func(w http.ResponseWriter, req *http.Request) {
+							w.Header().Set("X-Checked", "true")
+							Stop(req)
+						}
+						recorder := serve()
+						Ω(forwarded).Should(BeZero())
+						Ω(recorder.Code).Should(Equal(http.StatusOK))
+						Ω(recorder.Header().Get("X-Checked")).Should(Equal("true"))
+					})
+
+					It("should pass the request on when the plugin calls the next plugin", func() {
+						var status int
+						control = func(w http.ResponseWriter, req *http.Request) {
+							ioutil.ReadAll(req.Body)
+							tracker := httptest.NewRecorder()
+							Next(tracker, req)
+							status = tracker.Code
+							w.Header().Set("X-Next-Status", strconv.Itoa(status))
+							w.WriteHeader(tracker.Code)
+						}
+						recorder := serve()
+						Ω(forwarded).Should(Equal(1))
+						Ω(status).Should(Equal(http.StatusAccepted))
+						Ω(recorder.Header().Get("X-Next-Status")).Should(Equal("202"))
+					})
+
+					It("should pass the whole body on when called by the plugin", func() {
+						control = func(w http.ResponseWriter, req *http.Request) {
+							ioutil.ReadAll(req.Body)
+							Next(w, req)
+							Next(w, req)
+						}
+						recorder := serve()
+						Ω(forwarded).Should(Equal(1))
+						Ω(recorder.Code).Should(Equal(http.StatusAccepted))
+						Ω(recorder.Header().Get("X-Forwarded-Body")).Should(Equal("payload"))
+					})
+
+					It("should keep passing the request on implicitly", func() {
+						control = func(w http.ResponseWriter, req *http.Request) {
+							w.Header().Set("X-Checked", "true")
+						}
+						recorder := serve()
+						Ω(forwarded).Should(Equal(1))
+						Ω(recorder.Code).Should(Equal(http.StatusAccepted))
+						Ω(recorder.Header().Get("X-Checked")).Should(Equal("true"))
+					})
+				})
+
+				Context("and a middleware plugin", func() {
+					var read, forwarded string
+
+					BeforeEach(func() {
+						read, forwarded = "", ""
+						fakeSocket.ProxyHTTPReturns(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							data, _ := ioutil.ReadAll(req.Body)
+							forwarded = string(data)
+							http.Error(w, "upstream failed", http.StatusInternalServerError)
+						}))
+						handler = Middleware(func(next http.Handler) http.Handler {
+							return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+								data, _ := ioutil.ReadAll(req.Body)
+								read = string(data)
+
+								response := &ResponseBuffer{}
+								next.ServeHTTP(response, req)
+								if response.StatusCode >= 500 {
+									response.StatusCode = http.StatusServiceUnavailable
+									response.Body.Reset()
+									response.Body.WriteString("try again later")
+								}
+								response.Send(w)
+							})
+						})
+					})
+
+					serve := func() *httptest.ResponseRecorder {
+						_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+						req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+						recorder := httptest.NewRecorder()
+						argHandler.ServeHTTP(recorder, req)
+						return recorder
+					}
+
+					It("should let the plugin rewrite the response of the next plugin", func() {
+						recorder := serve()
+						Ω(recorder.Code).Should(Equal(http.StatusServiceUnavailable))
+						Ω(recorder.Body.String()).Should(Equal("try again later"))
+					})
+
+					It("should pass the whole body on to the next plugin", func() {
+						serve()
+						Ω(read).Should(Equal("payload"))
+						Ω(forwarded).Should(Equal("payload"))
+					})
+
+					Context("declaring that it only needs headers", func() {
+						BeforeEach(func() {
+							handler = HeadersOnly(handler)
+						})
+
+						It("should pass the body on without giving it to the plugin", func() {
+							serve()
+							Ω(read).Should(BeEmpty())
+							Ω(forwarded).Should(Equal("payload"))
+						})
+					})
+				})
+
+				Context("and a timeout for the next plugin", func() {
+					BeforeEach(func() {
+						config = []byte(fmt.Sprintf(`{"forward_socket_path":"%s","forward_plugin":"slow-sloth","forward_timeout":%d,"request_id_header":"X-Trace"}`,
+							forwardSocketPath, 20*time.Millisecond))
+						handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+						fakeSocket.ProxyHTTPReturns(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							<-req.Context().Done()
+							w.WriteHeader(http.StatusBadGateway)
+						}))
+					})
+
+					It("should reply with a gateway timeout if the next plugin does not respond in time", func() {
+						_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+						req := httptest.NewRequest("GET", "/", nil)
+						req.Header.Set("X-Trace", "0815")
+						recorder := httptest.NewRecorder()
+						argHandler.ServeHTTP(recorder, req)
+
+						Ω(recorder.Code).Should(Equal(http.StatusGatewayTimeout))
+						Ω(recorder.Body.String()).Should(ContainSubstring(`plugin "slow-sloth" did not respond in time (request ID 0815)`))
+						Ω(recorder.Header().Get(TimedOutHeader)).Should(Equal("slow-sloth"))
+					})
+				})
+
+				Context("and a request with a deadline", func() {
+					var deadline time.Time
+					var forwarded *http.Request
+
+					BeforeEach(func() {
+						config = []byte(fmt.Sprintf(`{"forward_socket_path":"%s","forward_plugin":"slow-sloth","forward_timeout":%d}`,
+							forwardSocketPath, time.Minute))
+						handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+						fakeSocket.ProxyHTTPReturns(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							forwarded = req
+							<-req.Context().Done()
+							w.WriteHeader(http.StatusBadGateway)
+						}))
+					})
+
+					serve := func() *httptest.ResponseRecorder {
+						_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+						deadline = time.Now().Add(50 * time.Millisecond)
+						req := httptest.NewRequest("GET", "/", nil)
+						req.Header.Set(DeadlineHeader, deadline.Format(time.RFC3339Nano))
+						recorder := httptest.NewRecorder()
+						argHandler.ServeHTTP(recorder, req)
+						return recorder
+					}
+
+					It("should give the next plugin no more than the remaining time", func() {
+						recorder := serve()
+						Ω(recorder.Code).Should(Equal(http.StatusGatewayTimeout))
+						Ω(time.Now()).Should(BeTemporally("<", deadline.Add(time.Second)))
+
+						passedOn, err := time.Parse(time.RFC3339Nano, forwarded.Header.Get(DeadlineHeader))
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(passedOn).Should(BeTemporally("<", deadline))
+					})
+
+					Context("and a later plugin times out", func() {
+						BeforeEach(func() {
+							fakeSocket.ProxyHTTPReturns(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+								w.Header().Set(TimedOutHeader, "lazy-koala")
+								w.WriteHeader(http.StatusGatewayTimeout)
+							}))
+						})
+
+						It("should name the plugin that timed out", func() {
+							recorder := serve()
+							Ω(recorder.Code).Should(Equal(http.StatusGatewayTimeout))
+							Ω(recorder.Body.String()).Should(ContainSubstring(`plugin "lazy-koala" did not respond in time`))
+							Ω(recorder.Header().Get(TimedOutHeader)).Should(Equal("lazy-koala"))
+						})
+					})
+				})
+			})
+
+			Context("and the config enables hub mode", func() {
+				var serveHop func(req *http.Request) (*httptest.ResponseRecorder, *http.Request)
+
+				BeforeEach(func() {
+					config = []byte(`{"forward_socket_path":"ignored","hub":true}`)
+					serveHop = func(req *http.Request) (*httptest.ResponseRecorder, *http.Request) {
+						_, argHandler := fakeSocket.NewHTTPServerArgsForCall(0)
+						recorder := httptest.NewRecorder()
+						next, err := ServeHop(argHandler, recorder, req)
+						Ω(err).ShouldNot(HaveOccurred())
+						return recorder, next
+					}
+				})
+
+				It("should not forward requests itself", func() {
+					Ω(fakeSocket.ProxyHTTPCallCount()).Should(BeZero())
+				})
+
+				Context("and a plugin passing requests on", func() {
+					BeforeEach(func() {
+						handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							ioutil.ReadAll(req.Body)
+							req.Header.Set("X-User", "mighty-grasshopper")
+							req.URL.Path = "/rewritten"
+							w.Header().Set("X-Checked", "true")
+						})
+					})
+
+					It("should return the request as the plugin has left it", func() {
+						req := httptest.NewRequest("PUT", "http://example.com/original?q=1", strings.NewReader("payload"))
+						recorder, next := serveHop(req)
+						Ω(next).ShouldNot(BeNil())
+						Ω(next.Method).Should(Equal("PUT"))
+						Ω(next.URL.String()).Should(Equal("/rewritten?q=1"))
+						Ω(next.Host).Should(Equal("example.com"))
+						Ω(next.Header.Get("X-User")).Should(Equal("mighty-grasshopper"))
+						Ω(next.Body).Should(Equal(http.NoBody))
+						Ω(recorder.Header().Get("X-Checked")).Should(Equal("true"))
+						Ω(recorder.Header().Get(ContinueHeader)).Should(BeEmpty())
+					})
+				})
+
+				Context("and a plugin responding", func() {
+					BeforeEach(func() {
+						handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							w.Header().Set("X-Checked", "true")
+							http.Error(w, "go away", http.StatusForbidden)
+						})
+					})
+
+					It("should pass the response on", func() {
+						recorder, next := serveHop(httptest.NewRequest("GET", "/", nil))
+						Ω(next).Should(BeNil())
+						Ω(recorder.Code).Should(Equal(http.StatusForbidden))
+						Ω(recorder.Body.String()).Should(Equal("go away\n"))
+						Ω(recorder.Header().Get("X-Checked")).Should(Equal("true"))
+					})
+				})
+
+				Context("and a plugin passing on a response that asks to continue", func() {
+					BeforeEach(func() {
+						handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							// like a backend answering with the header
+							w.Header().Set(ContinueHeader, "true")
+							w.Write([]byte("not a continuation"))
+						})
+					})
+
+					It("should pass the response on without the header", func() {
+						recorder, next := serveHop(httptest.NewRequest("GET", "/", nil))
+						Ω(next).Should(BeNil())
+						Ω(recorder.Code).Should(Equal(http.StatusOK))
+						Ω(recorder.Body.String()).Should(Equal("not a continuation"))
+						Ω(recorder.Header().Get(ContinueHeader)).Should(BeEmpty())
+					})
+				})
+
+				Context("and a plugin stopping the chain", func() {
+					BeforeEach(func() {
+						handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							w.Header().Set("X-Checked", "true")
+							Stop(req)
+						})
+					})
+
+					It("should end the chain at the plugin", func() {
+						recorder, next := serveHop(httptest.NewRequest("GET", "/", nil))
+						Ω(next).Should(BeNil())
+						Ω(recorder.Code).Should(Equal(http.StatusOK))
+						Ω(recorder.Header().Get("X-Checked")).Should(Equal("true"))
+					})
+				})
 			})
 		})
 	})
@@ -0,0 +1,380 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/SAP/gologger"
+)
+
+// stderrTailLines is the number of last stderr lines of a plugin that get
+// logged when the plugin exits unexpectedly.
+const stderrTailLines = 10
+
+// supervisor runs a plugin process and restarts it according to the
+// plugin's restart policy, until it gets closed.
+type supervisor struct {
+	name        string
+	socketPath  string
+	command     func() *exec.Cmd
+	policy      RestartPolicy
+	stopTimeout time.Duration
+	stderr      *lineTail
+
+	mutex     sync.Mutex
+	process   *os.Process
+	startedAt time.Time
+	restarts  int
+	stopping  bool
+	// supervising is true while the process is being supervised.
+	supervising bool
+	// restartRequested is set when the current process is stopped by
+	// restart rather than by crashing.
+	restartRequested bool
+	// exited is closed once the current process exits.
+	exited chan struct{}
+	// readiness of the current process.
+	readiness *readiness
+
+	stop chan struct{}
+	// kick cuts short the backoff before the next restart.
+	kick chan struct{}
+	// done is closed when supervising stops.
+	done chan struct{}
+}
+
+func newSupervisor(name, socketPath string, policy RestartPolicy, stopTimeout time.Duration, command func() *exec.Cmd) *supervisor {
+	done := make(chan struct{})
+	close(done)
+	return &supervisor{
+		name:        name,
+		socketPath:  socketPath,
+		command:     command,
+		policy:      policy,
+		stopTimeout: stopTimeout,
+		stderr:      newLineTail(stderrTailLines),
+		stop:        make(chan struct{}),
+		kick:        make(chan struct{}, 1),
+		done:        done,
+	}
+}
+
+// start starts the plugin process and begins supervising it.
+func (s *supervisor) start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cmd, err := s.spawnLocked()
+	if err != nil {
+		return err
+	}
+	s.supervising = true
+	s.done = make(chan struct{})
+	go s.supervise(cmd, s.done)
+	return nil
+}
+
+// close stops supervising the plugin and stops its process. The process is
+// interrupted first and killed if it does not exit within the stop timeout.
+func (s *supervisor) close() error {
+	s.mutex.Lock()
+	done := s.done
+	if s.stopping {
+		s.mutex.Unlock()
+		<-done
+		return nil
+	}
+	s.stopping = true
+	close(s.stop)
+	process, exited := s.process, s.exited
+	s.mutex.Unlock()
+	defer s.removeSocket()
+
+	if process != nil {
+		if err := s.terminate(process, exited); err != nil {
+			return err
+		}
+	}
+	<-done
+	return nil
+}
+
+// restart stops the current plugin process the same way close does and
+// starts a new one right away, regardless of the restart policy. A plugin
+// that is no longer supervised, because the restart policy gave up on it,
+// is started again.
+func (s *supervisor) restart() error {
+	s.mutex.Lock()
+	if s.stopping {
+		s.mutex.Unlock()
+		return PluginClosedErr
+	}
+	if !s.supervising {
+		s.restarts++
+		s.mutex.Unlock()
+		gologger.Infof("Starting plugin %q again on request", s.name)
+		return s.start()
+	}
+	process, exited := s.process, s.exited
+	if process == nil {
+		// the process is waiting for a restart already
+		s.mutex.Unlock()
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	s.restartRequested = true
+	s.mutex.Unlock()
+
+	gologger.Infof("Restarting plugin %q on request", s.name)
+	return s.terminate(process, exited)
+}
+
+// terminate interrupts the process and kills it if it does not exit within
+// the stop timeout.
+func (s *supervisor) terminate(process *os.Process, exited chan struct{}) error {
+	if err := process.Signal(os.Interrupt); err != nil {
+		gologger.Warnf("Failed to interrupt plugin %q: %v", s.name, err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(s.stopTimeout):
+		gologger.Warnf("Plugin %q did not exit within %v, killing it", s.name, s.stopTimeout)
+		if err := process.Kill(); err != nil {
+			return err
+		}
+		<-exited
+	}
+	return nil
+}
+
+// restartCount returns how many times the plugin has been restarted.
+func (s *supervisor) restartCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.restarts
+}
+
+// status returns the current state of the plugin process.
+func (s *supervisor) status() ReplicaStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := ReplicaStatus{
+		SocketPath: s.socketPath,
+		Restarts:   s.restarts,
+	}
+	if s.process != nil {
+		status.PID = s.process.Pid
+		status.StartedAt = s.startedAt
+	}
+	return status
+}
+
+// isReady reports whether the plugin process is running and has signaled
+// readiness.
+func (s *supervisor) isReady() bool {
+	s.mutex.Lock()
+	running, readiness := s.process != nil, s.readiness
+	s.mutex.Unlock()
+	if !running {
+		return false
+	}
+	select {
+	case <-readiness.done:
+		return readiness.err == nil
+	default:
+		return false
+	}
+}
+
+// waitReady waits for the current process to send its handshake.
+func (s *supervisor) waitReady(timeout time.Duration) (Handshake, error) {
+	s.mutex.Lock()
+	readiness := s.readiness
+	s.mutex.Unlock()
+
+	select {
+	case <-readiness.done:
+		return readiness.handshake, readiness.err
+	case <-time.After(timeout):
+		return Handshake{}, ReadyTimeoutError(timeout)
+	}
+}
+
+func (s *supervisor) spawn() (*exec.Cmd, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.spawnLocked()
+}
+
+func (s *supervisor) spawnLocked() (*exec.Cmd, error) {
+	if s.stopping {
+		return nil, PluginClosedErr
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyWriter.Close()
+
+	cmd := s.command()
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	if err := cmd.Start(); err != nil {
+		readyReader.Close()
+		return nil, err
+	}
+	s.process = cmd.Process
+	s.startedAt = time.Now()
+	s.exited = make(chan struct{})
+	s.readiness = &readiness{done: make(chan struct{})}
+	go s.readHandshake(readyReader, s.readiness)
+	return cmd, nil
+}
+
+// readiness describes whether a plugin process became ready.
+type readiness struct {
+	// done is closed once the handshake is received or fails.
+	done      chan struct{}
+	handshake Handshake
+	err       error
+}
+
+func (s *supervisor) readHandshake(reader io.ReadCloser, r *readiness) {
+	defer close(r.done)
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(&r.handshake); err != nil {
+		if err == io.EOF {
+			err = ExitedBeforeReadyErr
+		}
+		r.err = err
+		return
+	}
+	if r.err = checkVersion(r.handshake.ProtocolVersion); r.err != nil {
+		return
+	}
+	gologger.Infof("Plugin %q is ready (protocol version %d)", s.name, r.handshake.ProtocolVersion)
+}
+
+func (s *supervisor) supervise(cmd *exec.Cmd, done chan struct{}) {
+	defer func() {
+		s.mutex.Lock()
+		s.supervising = false
+		s.mutex.Unlock()
+		close(done)
+	}()
+
+	backoff := s.policy.Backoff
+	failures := 0
+	for {
+		exit := s.wait(cmd)
+		if exit.stopping {
+			return
+		}
+
+		var err error
+		cmd = nil
+		if exit.requested {
+			backoff, failures = s.policy.Backoff, 0
+			if cmd, err = s.respawn(); err == PluginClosedErr {
+				return
+			}
+		} else if exit.uptime >= s.policy.MaxBackoff {
+			backoff, failures = s.policy.Backoff, 0
+		}
+
+		success := exit.success && !exit.requested
+		for cmd == nil {
+			if !s.policy.shouldRestart(success, failures) {
+				gologger.Errorf("Plugin %q will not be restarted", s.name)
+				return
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-s.kick:
+			case <-time.After(backoff):
+			}
+
+			failures++
+			success = false
+			if backoff *= 2; backoff > s.policy.MaxBackoff {
+				backoff = s.policy.MaxBackoff
+			}
+			if cmd, err = s.respawn(); err == PluginClosedErr {
+				return
+			}
+		}
+	}
+}
+
+// respawn starts a new process in place of the exited one.
+func (s *supervisor) respawn() (*exec.Cmd, error) {
+	// the exited process might not have cleaned up its socket file
+	s.removeSocket()
+	cmd, err := s.spawn()
+	if err != nil {
+		if err != PluginClosedErr {
+			gologger.Errorf("Failed to restart plugin %q: %v", s.name, err)
+		}
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.restarts++
+	restarts := s.restarts
+	s.mutex.Unlock()
+	gologger.Infof("Restarted plugin %q (restart #%d)", s.name, restarts)
+	return cmd, nil
+}
+
+// exit describes how a plugin process exited.
+type exit struct {
+	success bool
+	uptime  time.Duration
+	// stopping is true when the process was stopped by close.
+	stopping bool
+	// requested is true when the process was stopped by restart.
+	requested bool
+}
+
+// wait waits for the process to exit and reports how it exited.
+func (s *supervisor) wait(cmd *exec.Cmd) exit {
+	cmd.Wait()
+
+	s.mutex.Lock()
+	uptime := time.Since(s.startedAt)
+	stopping, requested := s.stopping, s.restartRequested
+	s.restartRequested = false
+	exited := s.exited
+	s.process = nil
+	s.mutex.Unlock()
+	close(exited)
+
+	state := cmd.ProcessState
+	if !stopping && !requested {
+		gologger.Errorf("Plugin %q (pid %d) exited unexpectedly after %v with code %d (%s)",
+			s.name, state.Pid(), uptime, state.ExitCode(), state)
+		for _, line := range s.stderr.Lines() {
+			gologger.Errorf("Plugin %q stderr: %s", s.name, line)
+		}
+	}
+	return exit{
+		success:   state.Success(),
+		uptime:    uptime,
+		stopping:  stopping,
+		requested: requested,
+	}
+}
+
+func (s *supervisor) removeSocket() {
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		gologger.Warnf("Failed to remove socket file of plugin %q: %v", s.name, err)
+	}
+}
@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RestartPolicy", func() {
+	DescribeTable("shouldRestart", func(policy RestartPolicy, success bool, restarts int, expected bool) {
+		Ω(policy.shouldRestart(success, restarts)).Should(Equal(expected))
+	},
+		Entry("on-failure after failure", RestartPolicy{Mode: RestartOnFailure}, false, 0, true),
+		Entry("on-failure after success", RestartPolicy{Mode: RestartOnFailure}, true, 0, false),
+		Entry("always after success", RestartPolicy{Mode: RestartAlways}, true, 0, true),
+		Entry("never after failure", RestartPolicy{Mode: RestartNever}, false, 0, false),
+		Entry("below max restarts", RestartPolicy{Mode: RestartAlways, MaxRestarts: 3}, false, 2, true),
+		Entry("at max restarts", RestartPolicy{Mode: RestartAlways, MaxRestarts: 3}, false, 3, false),
+	)
+
+	Describe("withDefaults", func() {
+		It("should default to restarting on failure", func() {
+			policy, err := RestartPolicy{}.withDefaults()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(RestartPolicy{
+				Mode:       RestartOnFailure,
+				Backoff:    DefaultRestartBackoff,
+				MaxBackoff: DefaultMaxRestartBackoff,
+			}))
+		})
+
+		It("should reject unknown modes", func() {
+			_, err := RestartPolicy{Mode: "sometimes"}.withDefaults()
+			Ω(err).Should(Equal(UnsupportedRestartModeError("sometimes")))
+		})
+	})
+})
+
+var _ = Describe("Supervisor", func() {
+
+	var script string
+	var policy RestartPolicy
+	var stopTimeout time.Duration
+	var socketPath string
+	var starts chan struct{}
+
+	var sup *supervisor
+
+	BeforeEach(func() {
+		policy = RestartPolicy{
+			Mode:       RestartOnFailure,
+			Backoff:    time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+		}
+		stopTimeout = time.Second
+		starts = make(chan struct{}, 100)
+
+		file, err := ioutil.TempFile("", "aker-supervisor")
+		Ω(err).ShouldNot(HaveOccurred())
+		file.Close()
+		socketPath = file.Name()
+	})
+
+	JustBeforeEach(func() {
+		sup = newSupervisor("test", socketPath, policy, stopTimeout, func() *exec.Cmd {
+			starts <- struct{}{}
+			cmd := exec.Command("sh", "-c", script)
+			stderr := newLogWriter("test", GinkgoWriter)
+			stderr.tail = sup.stderr
+			cmd.Stderr = stderr
+			return cmd
+		})
+		Ω(sup.start()).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		Ω(sup.close()).Should(Succeed())
+		os.Remove(socketPath)
+	})
+
+	Context("when the plugin keeps failing", func() {
+		BeforeEach(func() {
+			script = "echo crashing >&2; exit 3"
+			policy.MaxRestarts = 2
+		})
+
+		It("should restart it up to the maximum restart count", func() {
+			Eventually(sup.done).Should(BeClosed())
+			Ω(starts).Should(HaveLen(3))
+			Ω(sup.restartCount()).Should(Equal(2))
+		})
+
+		It("should keep the last lines of stderr", func() {
+			Eventually(sup.done).Should(BeClosed())
+			Ω(sup.stderr.Lines()).Should(Equal([]string{"crashing", "crashing", "crashing"}))
+		})
+
+		It("should clean up the stale socket file before restarting", func() {
+			Eventually(sup.done).Should(BeClosed())
+			_, err := os.Stat(socketPath)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+	})
+
+	Context("when the plugin exits successfully", func() {
+		BeforeEach(func() {
+			script = "exit 0"
+		})
+
+		It("should not restart it on failure mode", func() {
+			Eventually(sup.done).Should(BeClosed())
+			Ω(starts).Should(HaveLen(1))
+		})
+
+		Context("and the restart mode is always", func() {
+			BeforeEach(func() {
+				policy.Mode = RestartAlways
+				policy.MaxRestarts = 1
+			})
+
+			It("should restart it", func() {
+				Eventually(sup.done).Should(BeClosed())
+				Ω(starts).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Context("when the plugin fails and the restart mode is never", func() {
+		BeforeEach(func() {
+			script = "exit 1"
+			policy.Mode = RestartNever
+		})
+
+		It("should not restart it", func() {
+			Eventually(sup.done).Should(BeClosed())
+			Ω(starts).Should(HaveLen(1))
+		})
+
+		It("should start it again when restarted on request", func() {
+			Eventually(sup.done).Should(BeClosed())
+			Ω(sup.restart()).Should(Succeed())
+			Eventually(starts).Should(HaveLen(2))
+			Ω(sup.restartCount()).Should(Equal(1))
+		})
+	})
+
+	Context("when the plugin is running", func() {
+		BeforeEach(func() {
+			script = "exec sleep 10"
+		})
+
+		It("should stop it when closed", func() {
+			Ω(sup.close()).Should(Succeed())
+			Ω(sup.done).Should(BeClosed())
+			Ω(starts).Should(HaveLen(1))
+		})
+
+		It("should report its process", func() {
+			status := sup.status()
+			Ω(status.PID).ShouldNot(BeZero())
+			Ω(status.SocketPath).Should(Equal(socketPath))
+			Ω(status.StartedAt).ShouldNot(BeZero())
+		})
+
+		It("should replace the process when restarted on request", func() {
+			pid := sup.status().PID
+			Ω(sup.restart()).Should(Succeed())
+			Eventually(func() int { return sup.status().PID }).ShouldNot(Or(BeZero(), Equal(pid)))
+			Ω(starts).Should(HaveLen(2))
+			Ω(sup.restartCount()).Should(Equal(1))
+			Ω(sup.done).ShouldNot(BeClosed())
+		})
+
+		It("should refuse to restart once closed", func() {
+			Ω(sup.close()).Should(Succeed())
+			Ω(sup.restart()).Should(Equal(PluginClosedErr))
+		})
+	})
+
+	Context("when the plugin ignores interrupts", func() {
+		BeforeEach(func() {
+			script = `trap "" INT; while true; do sleep 0.01; done`
+			stopTimeout = 50 * time.Millisecond
+		})
+
+		It("should kill it after the stop timeout", func() {
+			// give the shell a chance to install the trap
+			time.Sleep(50 * time.Millisecond)
+			Ω(sup.close()).Should(Succeed())
+			Ω(sup.done).Should(BeClosed())
+			Ω(starts).Should(HaveLen(1))
+		})
+	})
+})
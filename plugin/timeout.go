@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SAP/gologger"
+)
+
+// DeadlineHeader carries the deadline of a request from plugin to plugin,
+// because only the cancellation of the request context crosses the socket.
+// It is reserved for Aker and stripped from incoming requests.
+const DeadlineHeader = "X-Aker-Deadline"
+
+// TimedOutHeader is set on the 504 Gateway Timeout replies to the name of
+// the plugin that did not respond in time.
+const TimedOutHeader = "X-Aker-Timed-Out"
+
+// hopMargin is how much earlier than its own deadline each plugin has to
+// respond to a request it passes on. That way, the plugin in front of a
+// plugin that does not respond in time replies first and names it.
+const hopMargin = 10 * time.Millisecond
+
+// TimeoutHandler returns a http.Handler that passes requests on to h, the
+// handler of the named plugin. If the request context reaches its deadline
+// before the plugin starts responding, the client gets a 504 Gateway Timeout
+// naming the plugin instead. A positive timeout shortens the deadline to the
+// time the plugin is given to respond. The deadline is passed on to the
+// plugin in the DeadlineHeader, and a gateway timeout the plugin replies
+// with on behalf of a later plugin keeps naming that plugin.
+//
+// The reply includes the ID returned by requestID, if it is not nil.
+func TimeoutHandler(h http.Handler, plugin string, timeout time.Duration, requestID func(*http.Request) string) http.Handler {
+	return &timeoutHandler{
+		handler:   h,
+		plugin:    plugin,
+		timeout:   timeout,
+		requestID: requestID,
+	}
+}
+
+type timeoutHandler struct {
+	handler   http.Handler
+	plugin    string
+	timeout   time.Duration
+	requestID func(*http.Request) string
+}
+
+func (h *timeoutHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header = req.Header.Clone()
+		req.Header.Set(DeadlineHeader, deadline.Add(-hopMargin).UTC().Format(time.RFC3339Nano))
+	}
+
+	writer := &timeoutWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		reply: func(plugin string) {
+			h.reply(w, req, plugin)
+		},
+	}
+	h.handler.ServeHTTP(writer, req)
+	if !writer.started && ctx.Err() == context.DeadlineExceeded {
+		writer.started = true
+		h.reply(w, req, h.plugin)
+	}
+}
+
+func (h *timeoutHandler) reply(w http.ResponseWriter, req *http.Request, plugin string) {
+	if plugin == "" {
+		plugin = h.plugin
+	}
+	message := fmt.Sprintf("%s: plugin %q did not respond in time", http.StatusText(http.StatusGatewayTimeout), plugin)
+	if h.requestID != nil {
+		if id := h.requestID(req); id != "" {
+			message += fmt.Sprintf(" (request ID %s)", id)
+		}
+	}
+	gologger.Warnf("Plugin %q timed out serving %s %s", plugin, req.Method, req.URL.Path)
+	w.Header().Set(TimedOutHeader, plugin)
+	http.Error(w, message, http.StatusGatewayTimeout)
+}
+
+// timeoutWriter replaces the response with the timeout reply if the
+// response has not been started before the deadline, or if it is the
+// timeout reply of a later plugin. Whatever the handler writes afterwards is
+// discarded.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+	// reply is called with the name of the plugin that timed out, which is
+	// empty if it is the one of the handler.
+	reply    func(plugin string)
+	started  bool
+	timedOut bool
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	if later := w.Header().Get(TimedOutHeader); status == http.StatusGatewayTimeout && later != "" {
+		w.timedOut = true
+		w.reply(later)
+		return
+	}
+	if w.ctx.Err() == context.DeadlineExceeded {
+		w.timedOut = true
+		w.reply("")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.timedOut {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) Flush() {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.timedOut {
+		flusher.Flush()
+	}
+}
+
+// hopDeadline returns the time the handler in front of a plugin gives up on
+// a request, if any. That is the deadline of the request context inside
+// Aker, or hopMargin after the deadline passed on to the plugin when the
+// request arrives on a socket.
+func hopDeadline(req *http.Request) (time.Time, bool) {
+	if deadline, ok := req.Context().Deadline(); ok {
+		return deadline, true
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, req.Header.Get(DeadlineHeader))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return deadline.Add(hopMargin), true
+}
+
+// withDeadline returns a handler that applies the deadline a request arrives
+// with in the DeadlineHeader to its context before passing it on to h. The
+// header is removed, so that it does not reach the backends.
+func withDeadline(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		value := req.Header.Get(DeadlineHeader)
+		if value == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+		req.Header = req.Header.Clone()
+		req.Header.Del(DeadlineHeader)
+		deadline, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			h.ServeHTTP(w, req)
+			return
+		}
+		ctx, cancel := context.WithDeadline(req.Context(), deadline)
+		defer cancel()
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
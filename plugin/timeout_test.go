@@ -0,0 +1,130 @@
+package plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/SAP/aker/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TimeoutHandler", func() {
+	var plug http.Handler
+	var timeout time.Duration
+	var req *http.Request
+	var recorder *httptest.ResponseRecorder
+
+	requestID := func(req *http.Request) string {
+		return req.Header.Get("X-Aker-Request-Id")
+	}
+
+	// hang waits for the request to be done, like a proxy to a plugin that
+	// does not respond, and then fails like the proxy does.
+	hang := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("proxy error"))
+	})
+
+	BeforeEach(func() {
+		timeout = 20 * time.Millisecond
+		req = httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Aker-Request-Id", "0815")
+		recorder = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		TimeoutHandler(plug, "slow-sloth", timeout, requestID).ServeHTTP(recorder, req)
+	})
+
+	Context("when the plugin responds in time", func() {
+		BeforeEach(func() {
+			plug = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("tea"))
+			})
+		})
+
+		It("should pass the response on", func() {
+			Ω(recorder.Code).Should(Equal(http.StatusTeapot))
+			Ω(recorder.Body.String()).Should(Equal("tea"))
+		})
+	})
+
+	Context("when the plugin does not respond in time", func() {
+		BeforeEach(func() {
+			plug = hang
+		})
+
+		It("should reply with a gateway timeout naming the plugin", func() {
+			Ω(recorder.Code).Should(Equal(http.StatusGatewayTimeout))
+			Ω(recorder.Body.String()).Should(Equal(`Gateway Timeout: plugin "slow-sloth" did not respond in time (request ID 0815)` + "\n"))
+		})
+	})
+
+	Context("when the plugin gives up on its own after the deadline", func() {
+		BeforeEach(func() {
+			plug = http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				<-req.Context().Done()
+			})
+		})
+
+		It("should reply with a gateway timeout", func() {
+			Ω(recorder.Code).Should(Equal(http.StatusGatewayTimeout))
+		})
+	})
+
+	Context("when the request context has an earlier deadline", func() {
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			plug = hang
+			timeout = 0
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(req.Context(), 20*time.Millisecond)
+			req = req.WithContext(ctx)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should reply with a gateway timeout naming the plugin", func() {
+			Ω(recorder.Code).Should(Equal(http.StatusGatewayTimeout))
+			Ω(recorder.Body.String()).Should(ContainSubstring(`"slow-sloth"`))
+		})
+	})
+
+	Context("when the request is canceled", func() {
+		BeforeEach(func() {
+			plug = hang
+			timeout = time.Minute
+			ctx, cancel := context.WithCancel(req.Context())
+			cancel()
+			req = req.WithContext(ctx)
+		})
+
+		It("should not report a timeout", func() {
+			Ω(recorder.Code).Should(Equal(http.StatusBadGateway))
+		})
+	})
+
+	Context("when the plugin started responding before the deadline", func() {
+		BeforeEach(func() {
+			plug = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				<-req.Context().Done()
+				w.Write([]byte("partial"))
+			})
+		})
+
+		It("should keep the response", func() {
+			Ω(recorder.Code).Should(Equal(http.StatusOK))
+			Ω(recorder.Body.String()).Should(Equal("partial"))
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"sync"
+
+	"github.com/SAP/aker/config"
+	"github.com/SAP/aker/router"
+	"github.com/SAP/gologger"
+)
+
+// Reloader reloads the endpoints of a running Aker from its configuration
+// file.
+type Reloader struct {
+	configPath string
+	router     *router.Router
+	mutex      sync.Mutex
+}
+
+func NewReloader(configPath string, r *router.Router) *Reloader {
+	return &Reloader{
+		configPath: configPath,
+		router:     r,
+	}
+}
+
+// Reload reads the configuration file and applies its endpoints to the
+// router. Changes in the server section require a restart and are ignored.
+func (r *Reloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	gologger.Infof("Reloading configuration from %q...", r.configPath)
+	cfg, err := config.LoadFromFile(r.configPath)
+	if err != nil {
+		return err
+	}
+	if err := r.router.Apply(cfg.Endpoints); err != nil {
+		return err
+	}
+	gologger.Infof("Configuration reloaded")
+	return nil
+}
+
+// ReloadOnSignal reloads the configuration each time a signal is received
+// on c, which is meant to be notified of SIGHUP.
+func (r *Reloader) ReloadOnSignal(c <-chan os.Signal) {
+	for range c {
+		if err := r.Reload(); err != nil {
+			gologger.Errorf("Failed to reload configuration due to %q", err.Error())
+		}
+	}
+}
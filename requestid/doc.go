@@ -0,0 +1,6 @@
+// Package requestid assigns an ID to each request, so that it can be traced
+// across Aker, its plugins and the services behind them.
+//
+// Requests coming from trusted sources keep the ID they carry, provided it
+// has the expected format. All other requests get a newly generated one.
+package requestid
@@ -0,0 +1,21 @@
+package requestid
+
+import "fmt"
+
+type UnsupportedGeneratorError string
+
+func (e UnsupportedGeneratorError) Error() string {
+	return fmt.Sprintf("unsupported request ID generator: %q", string(e))
+}
+
+type UnsupportedFormatError string
+
+func (e UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("unsupported request ID format: %q", string(e))
+}
+
+type InvalidTrustedSourceError string
+
+func (e InvalidTrustedSourceError) Error() string {
+	return fmt.Sprintf("invalid trusted source: %q", string(e))
+}
@@ -0,0 +1,67 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/SAP/aker/uuid"
+)
+
+// Generator returns a new request ID.
+type Generator func() (string, error)
+
+// generator describes a Generator and the format of the IDs it generates.
+type generator struct {
+	generate Generator
+	format   string
+}
+
+var generators = map[string]generator{
+	"uuidv4": {generate: uuidV4, format: "uuid"},
+	"uuidv7": {generate: uuidV7, format: "uuid"},
+	"ulid":   {generate: ULID, format: "ulid"},
+}
+
+func uuidV4() (string, error) {
+	uid, err := uuid.Random()
+	if err != nil {
+		return "", err
+	}
+	return uid.String(), nil
+}
+
+func uuidV7() (string, error) {
+	uid, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return uid.String(), nil
+}
+
+// crockford is the base32 alphabet ULIDs are encoded with.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates a Universally Unique Lexicographically Sortable
+// Identifier: 48 bits of Unix time in milliseconds followed by 80 random
+// bits, encoded as 26 characters of Crockford's base32.
+func ULID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(id[0:6], timestamp[2:])
+
+	// 26 characters hold 130 bits, so the first one carries only 3 bits
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	var encoded [26]byte
+	for index := len(encoded) - 1; index >= 0; index-- {
+		encoded[index] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(encoded[:]), nil
+}
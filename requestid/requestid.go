@@ -0,0 +1,152 @@
+package requestid
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/SAP/aker/config"
+	"github.com/SAP/gologger"
+)
+
+// DefaultHeader is the header carrying the request ID, unless configured
+// otherwise.
+const DefaultHeader = "X-Aker-Request-Id"
+
+// DefaultGenerator is used when the configuration does not specify one.
+const DefaultGenerator = "uuidv4"
+
+var formats = map[string]*regexp.Regexp{
+	"uuid": regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`),
+	"ulid": regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Za-hjkmnp-tv-z]{25}$`),
+	"any":  regexp.MustCompile(`^[\x21-\x7e]{1,128}$`),
+}
+
+type contextKey struct{}
+
+// Policy decides which ID each request gets.
+type Policy struct {
+	header   string
+	generate Generator
+	format   *regexp.Regexp
+	trusted  []*net.IPNet
+}
+
+// New creates a Policy based on the provided configuration.
+func New(cfg config.RequestIDConfig) (*Policy, error) {
+	policy := &Policy{header: DefaultHeader}
+	if cfg.Header != "" {
+		policy.header = http.CanonicalHeaderKey(cfg.Header)
+	}
+
+	name := cfg.Generator
+	if name == "" {
+		name = DefaultGenerator
+	}
+	gen, ok := generators[name]
+	if !ok {
+		return nil, UnsupportedGeneratorError(name)
+	}
+	policy.generate = gen.generate
+
+	format := cfg.Format
+	if format == "" {
+		format = gen.format
+	}
+	if policy.format, ok = formats[format]; !ok {
+		return nil, UnsupportedFormatError(format)
+	}
+
+	for _, source := range cfg.TrustedSources {
+		network, err := parseSource(source)
+		if err != nil {
+			return nil, err
+		}
+		policy.trusted = append(policy.trusted, network)
+	}
+	return policy, nil
+}
+
+// parseSource parses a CIDR range or a single IP address.
+func parseSource(source string) (*net.IPNet, error) {
+	if strings.Contains(source, "/") {
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, InvalidTrustedSourceError(source)
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return nil, InvalidTrustedSourceError(source)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Header returns the name of the header carrying the request ID.
+func (p *Policy) Header() string {
+	return p.header
+}
+
+// Handler returns a http.Handler that sets the request ID header of each
+// request and its response before passing it on to h. The ID is also
+// stored in the request context.
+func (p *Policy) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := p.requestID(req)
+		if err != nil {
+			gologger.Errorf("Failed to generate request ID: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		req.Header.Set(p.header, id)
+		w.Header().Set(p.header, id)
+		h.ServeHTTP(w, req.WithContext(NewContext(req.Context(), id)))
+	})
+}
+
+// requestID returns the ID the request carries if its source is trusted and
+// the ID is valid, and a new one otherwise.
+func (p *Policy) requestID(req *http.Request) (string, error) {
+	if values := req.Header[p.header]; len(values) == 1 && p.format.MatchString(values[0]) && p.isTrusted(req.RemoteAddr) {
+		return values[0], nil
+	}
+	return p.generate()
+}
+
+func (p *Policy) isTrusted(remoteAddr string) bool {
+	if len(p.trusted) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContext returns a copy of ctx carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
@@ -0,0 +1,16 @@
+package requestid_test
+
+import (
+	"github.com/SAP/gologger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	gologger.DefaultLogger = gologger.NewNativeLogger(GinkgoWriter, GinkgoWriter)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RequestID Suite")
+}
@@ -0,0 +1,194 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/SAP/aker/config"
+	. "github.com/SAP/aker/requestid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const incomingID = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+var _ = Describe("Policy", func() {
+	var cfg config.RequestIDConfig
+	var policy *Policy
+	var err error
+
+	BeforeEach(func() {
+		cfg = config.RequestIDConfig{}
+	})
+
+	JustBeforeEach(func() {
+		policy, err = New(cfg)
+	})
+
+	serve := func(remoteAddr string, ids ...string) (*http.Request, *httptest.ResponseRecorder) {
+		req, err := http.NewRequest("GET", "http://aker.me/", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		req.RemoteAddr = remoteAddr
+		for _, id := range ids {
+			req.Header.Add(policy.Header(), id)
+		}
+
+		var received *http.Request
+		rr := httptest.NewRecorder()
+		policy.Handler(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			received = req
+		})).ServeHTTP(rr, req)
+		return received, rr
+	}
+
+	Context("with the default configuration", func() {
+		It("should not return an error", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy.Header()).Should(Equal(DefaultHeader))
+		})
+
+		It("should set a generated ID on the request and the response", func() {
+			received, rr := serve("10.0.0.1:1234")
+			id := received.Header.Get(DefaultHeader)
+			Ω(id).Should(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`))
+			Ω(rr.Header().Get(DefaultHeader)).Should(Equal(id))
+		})
+
+		It("should store the ID in the request context", func() {
+			received, _ := serve("10.0.0.1:1234")
+			id, ok := FromContext(received.Context())
+			Ω(ok).Should(BeTrue())
+			Ω(id).Should(Equal(received.Header.Get(DefaultHeader)))
+		})
+
+		It("should replace IDs from untrusted sources", func() {
+			received, _ := serve("10.0.0.1:1234", incomingID)
+			Ω(received.Header[DefaultHeader]).Should(HaveLen(1))
+			Ω(received.Header.Get(DefaultHeader)).ShouldNot(Equal(incomingID))
+		})
+	})
+
+	Context("with trusted sources", func() {
+		BeforeEach(func() {
+			cfg.TrustedSources = []string{"10.0.0.0/8", "192.168.1.5", "::1"}
+		})
+
+		It("should keep valid IDs from trusted sources", func() {
+			received, rr := serve("10.1.2.3:1234", incomingID)
+			Ω(received.Header[DefaultHeader]).Should(Equal([]string{incomingID}))
+			Ω(rr.Header().Get(DefaultHeader)).Should(Equal(incomingID))
+
+			received, _ = serve("192.168.1.5:1234", incomingID)
+			Ω(received.Header.Get(DefaultHeader)).Should(Equal(incomingID))
+
+			received, _ = serve("[::1]:1234", incomingID)
+			Ω(received.Header.Get(DefaultHeader)).Should(Equal(incomingID))
+		})
+
+		It("should replace IDs from other sources", func() {
+			received, _ := serve("192.168.1.6:1234", incomingID)
+			Ω(received.Header.Get(DefaultHeader)).ShouldNot(Equal(incomingID))
+		})
+
+		It("should replace invalid IDs", func() {
+			received, _ := serve("10.1.2.3:1234", "not-a-uuid")
+			Ω(received.Header.Get(DefaultHeader)).ShouldNot(Equal("not-a-uuid"))
+		})
+
+		It("should replace multiple IDs with a single one", func() {
+			received, _ := serve("10.1.2.3:1234", incomingID, incomingID)
+			Ω(received.Header[DefaultHeader]).Should(HaveLen(1))
+			Ω(received.Header.Get(DefaultHeader)).ShouldNot(Equal(incomingID))
+		})
+
+		Context("and any format", func() {
+			BeforeEach(func() {
+				cfg.Format = "any"
+			})
+
+			It("should keep IDs of printable characters", func() {
+				received, _ := serve("10.1.2.3:1234", "lb-1234/abc")
+				Ω(received.Header.Get(DefaultHeader)).Should(Equal("lb-1234/abc"))
+
+				received, _ = serve("10.1.2.3:1234", "with space")
+				Ω(received.Header.Get(DefaultHeader)).ShouldNot(Equal("with space"))
+			})
+		})
+	})
+
+	Context("with a custom header", func() {
+		BeforeEach(func() {
+			cfg.Header = "x-request-id"
+		})
+
+		It("should use the canonical header name", func() {
+			Ω(policy.Header()).Should(Equal("X-Request-Id"))
+			received, _ := serve("10.0.0.1:1234")
+			Ω(received.Header.Get("X-Request-Id")).ShouldNot(BeEmpty())
+			Ω(received.Header.Get(DefaultHeader)).Should(BeEmpty())
+		})
+	})
+
+	Context("with the uuidv7 generator", func() {
+		BeforeEach(func() {
+			cfg.Generator = "uuidv7"
+		})
+
+		It("should generate version 7 UUIDs", func() {
+			received, _ := serve("10.0.0.1:1234")
+			Ω(received.Header.Get(DefaultHeader)).Should(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		})
+	})
+
+	Context("with the ulid generator", func() {
+		BeforeEach(func() {
+			cfg.Generator = "ulid"
+			cfg.TrustedSources = []string{"10.0.0.0/8"}
+		})
+
+		It("should generate ULIDs", func() {
+			received, _ := serve("10.0.0.1:1234")
+			Ω(received.Header.Get(DefaultHeader)).Should(MatchRegexp(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`))
+		})
+
+		It("should validate incoming IDs as ULIDs", func() {
+			received, _ := serve("10.0.0.1:1234", "01ARZ3NDEKTSV4RRFFQ69G5FAV")
+			Ω(received.Header.Get(DefaultHeader)).Should(Equal("01ARZ3NDEKTSV4RRFFQ69G5FAV"))
+
+			received, _ = serve("10.0.0.1:1234", incomingID)
+			Ω(received.Header.Get(DefaultHeader)).ShouldNot(Equal(incomingID))
+		})
+	})
+
+	DescribeTable("invalid configuration", func(cfg config.RequestIDConfig, expected error) {
+		_, err := New(cfg)
+		Ω(err).Should(Equal(expected))
+	},
+		Entry("generator", config.RequestIDConfig{Generator: "sequence"}, UnsupportedGeneratorError("sequence")),
+		Entry("format", config.RequestIDConfig{Format: "hex"}, UnsupportedFormatError("hex")),
+		Entry("CIDR", config.RequestIDConfig{TrustedSources: []string{"10.0.0.0/33"}}, InvalidTrustedSourceError("10.0.0.0/33")),
+		Entry("IP", config.RequestIDConfig{TrustedSources: []string{"lb.local"}}, InvalidTrustedSourceError("lb.local")),
+	)
+})
+
+var _ = Describe("ULID", func() {
+	It("should sort by creation time", func() {
+		first, err := ULID()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(first).Should(HaveLen(26))
+
+		second, err := ULID()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(first[:10] <= second[:10]).Should(BeTrue())
+	})
+})
+
+var _ = Describe("FromContext", func() {
+	It("should report a missing ID", func() {
+		_, ok := FromContext(context.Background())
+		Ω(ok).Should(BeFalse())
+	})
+})
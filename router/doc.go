@@ -0,0 +1,4 @@
+// Package router dispatches incoming requests to Aker endpoints. The set of
+// endpoints can be replaced at runtime without interrupting the requests that
+// are already being served.
+package router
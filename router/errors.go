@@ -0,0 +1,70 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ClosedErr is returned by Apply once the router is closed.
+var ClosedErr = errors.New("router is closed")
+
+type DuplicateEndpointError string
+
+func (e DuplicateEndpointError) Error() string {
+	return fmt.Sprintf("duplicate endpoint: %q", string(e))
+}
+
+type UnknownEndpointError string
+
+func (e UnknownEndpointError) Error() string {
+	return fmt.Sprintf("unknown endpoint: %q", string(e))
+}
+
+type InvalidHostError string
+
+func (e InvalidHostError) Error() string {
+	return fmt.Sprintf("invalid endpoint host: %q", string(e))
+}
+
+type InvalidPathTemplateError string
+
+func (e InvalidPathTemplateError) Error() string {
+	return fmt.Sprintf("invalid endpoint path template: %q", string(e))
+}
+
+type InvalidPathRegexError struct {
+	Regex string
+	Err   error
+}
+
+func (e *InvalidPathRegexError) Error() string {
+	return fmt.Sprintf("invalid endpoint path regex %q: %v", e.Regex, e.Err)
+}
+
+// ConflictingEndpointError is returned when an endpoint has the same route
+// as an endpoint defined in another configuration file.
+type ConflictingEndpointError struct {
+	ID string
+	// Source is the configuration file of the other endpoint.
+	Source string
+}
+
+func (e *ConflictingEndpointError) Error() string {
+	return fmt.Sprintf("duplicate endpoint: %q, already defined in %q", e.ID, e.Source)
+}
+
+// EndpointError is returned for the endpoint at Index by Validate, and by
+// Apply for endpoints whose configuration file is known.
+type EndpointError struct {
+	Index int
+	// Source is the configuration file of the endpoint, if known.
+	Source string
+	Err    error
+}
+
+func (e *EndpointError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("endpoint of %q: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("endpoint %d: %v", e.Index, e.Err)
+}
@@ -0,0 +1,253 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/SAP/aker/config"
+)
+
+// ParamHeaderPrefix prefixes the request headers that carry the parameters
+// matched by path templates and named groups of path regular expressions.
+// Such headers are removed from incoming requests, so plugins can trust them.
+const ParamHeaderPrefix = "X-Aker-Param-"
+
+// matcher decides whether a request should be served by an endpoint.
+type matcher struct {
+	// pattern is a literal path following the http.ServeMux conventions. It
+	// is empty when path is set.
+	pattern string
+	// path matches templated paths and path regular expressions.
+	path *regexp.Regexp
+
+	methods map[string]bool
+	headers map[string]string
+	query   map[string]string
+
+	// score ranks matchers by how specific their path is.
+	score int
+	// key identifies the matcher among the matchers of a host.
+	key string
+	// route is the key with the path expression in canonical form, so that
+	// paths matching the same requests compare equal.
+	route string
+}
+
+var templateParam = regexp.MustCompile(`^\{([A-Za-z0-9_]+)\}$`)
+
+func newMatcher(endpointCfg config.Endpoint) (*matcher, error) {
+	m := &matcher{
+		headers: endpointCfg.Match.Headers,
+		query:   endpointCfg.Match.Query,
+	}
+
+	switch {
+	case endpointCfg.PathRegex != "":
+		// the expression is compiled on its own first, so that errors refer
+		// to the expression as it was configured
+		if _, err := regexp.Compile(endpointCfg.PathRegex); err != nil {
+			return nil, &InvalidPathRegexError{Regex: endpointCfg.PathRegex, Err: err}
+		}
+		// the expression has to match the whole path
+		path, err := regexp.Compile("^(?:" + endpointCfg.PathRegex + ")$")
+		if err != nil {
+			return nil, &InvalidPathRegexError{Regex: endpointCfg.PathRegex, Err: err}
+		}
+		m.path = path
+		prefix, _ := path.LiteralPrefix()
+		m.score = len(prefix)
+	case strings.Contains(endpointCfg.Path, "{"):
+		path, score, err := compileTemplate(endpointCfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		m.path, m.score = path, score
+	default:
+		m.pattern = endpointCfg.Path
+		m.score = len(endpointCfg.Path)
+	}
+
+	if len(endpointCfg.Match.Methods) > 0 {
+		m.methods = make(map[string]bool, len(endpointCfg.Match.Methods))
+		for _, method := range endpointCfg.Match.Methods {
+			m.methods[strings.ToUpper(method)] = true
+		}
+	}
+	m.key = matchKey(endpointCfg)
+	m.route = m.pattern
+	if m.path != nil {
+		m.route = "~" + canonical(m.path)
+	}
+	m.route += predicateKey(endpointCfg.Match)
+	return m, nil
+}
+
+// canonical returns the simplified expression without the names of its
+// groups, so that templates and regular expressions that differ only in the
+// names of their parameters compare equal.
+func canonical(path *regexp.Regexp) string {
+	expression, err := syntax.Parse(path.String(), syntax.Perl)
+	if err != nil {
+		return path.String()
+	}
+	expression = expression.Simplify()
+	unname(expression)
+	return expression.String()
+}
+
+func unname(expression *syntax.Regexp) {
+	expression.Name = ""
+	for _, sub := range expression.Sub {
+		unname(sub)
+	}
+}
+
+// compileTemplate turns a path like "/users/{id}/" into a regular
+// expression. Each parameter matches a single path segment. The score of
+// the template is the number of its literal characters, with each parameter
+// counting as one.
+func compileTemplate(template string) (*regexp.Regexp, int, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, 0, InvalidPathTemplateError(template)
+	}
+	subtree := strings.HasSuffix(template, "/")
+	segments := strings.Split(strings.Trim(template, "/"), "/")
+
+	expression := "^"
+	score := len(template)
+	seen := make(map[string]bool)
+	for _, segment := range segments {
+		expression += "/"
+		if !strings.ContainsAny(segment, "{}") {
+			expression += regexp.QuoteMeta(segment)
+			continue
+		}
+		param := templateParam.FindStringSubmatch(segment)
+		if param == nil || seen[param[1]] {
+			return nil, 0, InvalidPathTemplateError(template)
+		}
+		seen[param[1]] = true
+		expression += fmt.Sprintf("(?P<%s>[^/]+)", param[1])
+		score -= len(segment) - 1
+	}
+	if subtree {
+		expression += "/"
+	} else {
+		expression += "$"
+	}
+	return regexp.MustCompile(expression), score, nil
+}
+
+// predicates returns the number of conditions besides the path.
+func (m *matcher) predicates() int {
+	count := len(m.headers) + len(m.query)
+	if m.methods != nil {
+		count++
+	}
+	return count
+}
+
+// match reports whether the request with the specified path matches and
+// returns the parameters extracted from the path.
+func (m *matcher) match(req *http.Request, path string) (map[string]string, bool) {
+	if m.methods != nil && !m.methods[req.Method] {
+		return nil, false
+	}
+	for name, value := range m.headers {
+		if !valueMatches(req.Header[http.CanonicalHeaderKey(name)], value) {
+			return nil, false
+		}
+	}
+	if len(m.query) > 0 {
+		query := req.URL.Query()
+		for name, value := range m.query {
+			if !valueMatches(query[name], value) {
+				return nil, false
+			}
+		}
+	}
+
+	if m.path == nil {
+		return nil, pathMatches(m.pattern, path)
+	}
+	groups := m.path.FindStringSubmatch(path)
+	if groups == nil {
+		return nil, false
+	}
+	var params map[string]string
+	for index, name := range m.path.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = groups[index]
+	}
+	return params, true
+}
+
+func valueMatches(values []string, expected string) bool {
+	for _, value := range values {
+		if expected == "*" || value == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// matchKey describes the path and the predicates of an endpoint, e.g.
+// "/api/ methods=POST,PUT header:Content-Type=application/json".
+func matchKey(endpointCfg config.Endpoint) string {
+	key := endpointCfg.Path
+	if endpointCfg.PathRegex != "" {
+		key = "~" + endpointCfg.PathRegex
+	}
+	return key + predicateKey(endpointCfg.Match)
+}
+
+// predicateKey describes the predicates of an endpoint besides its path.
+func predicateKey(match config.Match) string {
+	var key string
+	if len(match.Methods) > 0 {
+		methods := make([]string, len(match.Methods))
+		for index, method := range match.Methods {
+			methods[index] = strings.ToUpper(method)
+		}
+		sort.Strings(methods)
+		key += " methods=" + strings.Join(methods, ",")
+	}
+	for _, name := range sortedKeys(match.Headers) {
+		key += " header:" + http.CanonicalHeaderKey(name) + "=" + match.Headers[name]
+	}
+	for _, name := range sortedKeys(match.Query) {
+		key += " query:" + name + "=" + match.Query[name]
+	}
+	return key
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setParams passes the parameters to plugins as request headers, replacing
+// any that the client sent.
+func setParams(header http.Header, params map[string]string) {
+	for name := range header {
+		if strings.HasPrefix(name, ParamHeaderPrefix) {
+			delete(header, name)
+		}
+	}
+	for name, value := range params {
+		header.Set(ParamHeaderPrefix+name, value)
+	}
+}
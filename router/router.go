@@ -0,0 +1,289 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/SAP/aker/config"
+	"github.com/SAP/aker/endpoint"
+	"github.com/SAP/gologger"
+)
+
+// Router is a http.Handler that routes requests to endpoint handlers.
+//
+// The endpoints are configured via Apply, which can be called at any time.
+// Requests that are already being served by a replaced endpoint are allowed
+// to finish before the endpoint's plugins are closed.
+type Router struct {
+	opener     endpoint.PluginOpener
+	middleware []Middleware
+
+	// mutex serializes Apply and Close.
+	mutex sync.Mutex
+	// closed is set as soon as Close is called, so that an Apply in
+	// progress stops opening endpoints.
+	closed   int32
+	table    atomic.Value
+	handlers map[string]*endpoint.Handler
+	retiring sync.WaitGroup
+}
+
+// Middleware wraps the handler of the endpoint with the specified ID.
+type Middleware func(id string, h http.Handler) http.Handler
+
+// New returns a Router without any endpoints. Plugins of the endpoints
+// configured later on are opened using the provided opener. The handler of
+// each endpoint is wrapped by the middleware, the first one outermost.
+func New(opener endpoint.PluginOpener, middleware ...Middleware) *Router {
+	r := &Router{
+		opener:     opener,
+		middleware: middleware,
+		handlers:   make(map[string]*endpoint.Handler),
+	}
+	r.table.Store(newTable())
+	return r
+}
+
+// Apply replaces the endpoints served by the router with the specified ones.
+//
+// Endpoints whose configuration has not changed keep running. New and changed
+// endpoints get their plugin chains opened, and once all of them are ready
+// the routing table is swapped atomically. Removed and replaced endpoints are
+// closed in the background, after their in-flight requests finish.
+//
+// If any of the endpoints fails to open, the plugins opened so far are closed
+// and the router keeps serving the previous endpoints. Once the router is
+// closed, ClosedErr is returned, even if Close is called while the endpoints
+// are being opened.
+func (r *Router) Apply(endpoints []config.Endpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return ClosedErr
+	}
+
+	// validate the routes before starting any plugins
+	if _, err := r.buildTable(endpoints, nil); err != nil {
+		return err
+	}
+
+	handlers := make(map[string]*endpoint.Handler, len(endpoints))
+	var opened []*endpoint.Handler
+	for index, endpointCfg := range endpoints {
+		key := endpointKey(endpointCfg)
+		if current, ok := r.handlers[key]; ok && reflect.DeepEqual(current.Config(), endpointCfg) {
+			handlers[key] = current
+			continue
+		}
+		if atomic.LoadInt32(&r.closed) != 0 {
+			closeAll(opened)
+			return ClosedErr
+		}
+
+		gologger.Infof("Building plugin chain for endpoint: %q", key)
+		handler, err := endpoint.NewHandler(endpointCfg, r.opener)
+		if err != nil {
+			closeAll(opened)
+			return sourced(index, endpointCfg, err)
+		}
+		opened = append(opened, handler)
+		handlers[key] = handler
+	}
+
+	table, err := r.buildTable(endpoints, handlers)
+	if err != nil {
+		closeAll(opened)
+		return err
+	}
+	r.table.Store(table)
+
+	for key, handler := range r.handlers {
+		if handlers[key] != handler {
+			r.retire(handler)
+		}
+	}
+	r.handlers = handlers
+	for _, warning := range endpoint.SharingWarnings(endpoints) {
+		gologger.Warnf("Sharing plugins: %s", warning)
+	}
+	return nil
+}
+
+// ServeHTTP dispatches the request to the endpoint of the request's host
+// whose path matches the request URL best.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.table.Load().(*table).ServeHTTP(w, req)
+}
+
+// buildTable builds the routing table of the endpoints. When handlers is
+// nil, the routes are only validated.
+func (r *Router) buildTable(endpoints []config.Endpoint, handlers map[string]*endpoint.Handler) (*table, error) {
+	t := newTable()
+	for index, endpointCfg := range endpoints {
+		key := endpointKey(endpointCfg)
+		var handler http.Handler = http.NotFoundHandler()
+		if handlers != nil {
+			handler = r.wrap(key, handlers[key])
+		}
+		if err := t.add(endpointCfg, handler); err != nil {
+			return nil, sourced(index, endpointCfg, err)
+		}
+	}
+	return t, nil
+}
+
+// sourced wraps the error of the endpoint in an *EndpointError naming its
+// configuration file, if it is known.
+func sourced(index int, endpointCfg config.Endpoint, err error) error {
+	if endpointCfg.Source == "" {
+		return err
+	}
+	return &EndpointError{Index: index, Source: endpointCfg.Source, Err: err}
+}
+
+// Validate checks the routes of the endpoints without opening any plugins.
+// It returns an *EndpointError for each endpoint whose route is invalid or
+// conflicts with the route of a previous endpoint.
+func Validate(endpoints []config.Endpoint) []error {
+	var errs []error
+	t := newTable()
+	for index, endpointCfg := range endpoints {
+		if err := t.add(endpointCfg, http.NotFoundHandler()); err != nil {
+			errs = append(errs, &EndpointError{Index: index, Source: endpointCfg.Source, Err: err})
+		}
+	}
+	return errs
+}
+
+// EndpointStatus describes the state of an endpoint served by the router.
+type EndpointStatus struct {
+	// ID identifies the endpoint in calls to the router.
+	ID string
+	endpoint.Status
+}
+
+// Endpoints returns the state of the served endpoints, ordered by ID.
+func (r *Router) Endpoints() []EndpointStatus {
+	r.mutex.Lock()
+	handlers := make(map[string]*endpoint.Handler, len(r.handlers))
+	for key, handler := range r.handlers {
+		handlers[key] = handler
+	}
+	r.mutex.Unlock()
+
+	statuses := make([]EndpointStatus, 0, len(handlers))
+	for key, handler := range handlers {
+		statuses = append(statuses, EndpointStatus{ID: key, Status: handler.Status()})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
+
+// RestartPlugin restarts the plugin at the specified position of the
+// endpoint's chain.
+func (r *Router) RestartPlugin(id string, position int) error {
+	handler, err := r.handler(id)
+	if err != nil {
+		return err
+	}
+	return handler.RestartPlugin(position)
+}
+
+// Drain makes the endpoint reject new requests and waits for the in-flight
+// ones to finish. The endpoint stays drained until it is resumed, even if
+// the same configuration is applied again.
+func (r *Router) Drain(id string) error {
+	handler, err := r.handler(id)
+	if err != nil {
+		return err
+	}
+	gologger.Infof("Draining endpoint: %q", id)
+	handler.Drain()
+	return nil
+}
+
+// Resume makes a drained endpoint accept requests again.
+func (r *Router) Resume(id string) error {
+	handler, err := r.handler(id)
+	if err != nil {
+		return err
+	}
+	gologger.Infof("Resuming endpoint: %q", id)
+	handler.Resume()
+	return nil
+}
+
+func (r *Router) handler(id string) (*endpoint.Handler, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	handler, ok := r.handlers[id]
+	if !ok {
+		return nil, UnknownEndpointError(id)
+	}
+	return handler, nil
+}
+
+// Close stops routing requests and closes all endpoints, including those
+// that are still being retired. It returns once all plugins have exited. An
+// Apply in progress stops opening endpoints, and the ones it has opened are
+// closed as well.
+func (r *Router) Close() {
+	atomic.StoreInt32(&r.closed, 1)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.table.Store(newTable())
+	for _, handler := range r.handlers {
+		r.retire(handler)
+	}
+	r.handlers = make(map[string]*endpoint.Handler)
+	r.retiring.Wait()
+}
+
+func (r *Router) retire(handler *endpoint.Handler) {
+	r.retiring.Add(1)
+	go func() {
+		defer r.retiring.Done()
+		key := endpointKey(handler.Config())
+		gologger.Infof("Closing endpoint: %q", key)
+		if err := handler.Close(); err != nil {
+			gologger.Errorf("Error closing endpoint %q: %v", key, err)
+		}
+	}()
+}
+
+func (r *Router) wrap(id string, handler http.Handler) http.Handler {
+	for index := len(r.middleware) - 1; index >= 0; index-- {
+		handler = r.middleware[index](id, handler)
+	}
+	return handler
+}
+
+// endpointKey identifies an endpoint by its hosts, path and predicates, e.g.
+// "*.example.com,example.com/api/ methods=POST". Endpoints without hosts and
+// predicates are identified by their path alone.
+func endpointKey(endpointCfg config.Endpoint) string {
+	if len(endpointCfg.Hosts) == 0 {
+		return matchKey(endpointCfg)
+	}
+	hosts := make([]string, len(endpointCfg.Hosts))
+	for index, host := range endpointCfg.Hosts {
+		hosts[index] = normalizeHost(host)
+	}
+	sort.Strings(hosts)
+	return strings.Join(hosts, ",") + matchKey(endpointCfg)
+}
+
+func closeAll(handlers []*endpoint.Handler) {
+	for _, handler := range handlers {
+		if err := handler.Close(); err != nil {
+			gologger.Errorf("Error closing endpoint %q: %v", endpointKey(handler.Config()), err)
+		}
+	}
+}
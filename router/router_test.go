@@ -0,0 +1,570 @@
+package router_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/SAP/aker/config"
+	"github.com/SAP/aker/endpoint/endpointfakes"
+	"github.com/SAP/aker/plugin"
+	. "github.com/SAP/aker/router"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Router", func() {
+
+	var opener *endpointfakes.FakePluginOpener
+	var router *Router
+
+	serveHost := func(host, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://"+host+path, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	serve := func(path string) string {
+		return serveHost("aker.me", path).Body.String()
+	}
+
+	hostEndpointCfg := func(hosts []string, path, pluginName string) config.Endpoint {
+		return config.Endpoint{
+			Hosts: hosts,
+			Path:  path,
+			Plugins: []config.PluginReference{
+				config.PluginReference{Name: pluginName},
+			},
+		}
+	}
+
+	endpointCfg := func(path, pluginName string) config.Endpoint {
+		return config.Endpoint{
+			Path: path,
+			Plugins: []config.PluginReference{
+				config.PluginReference{Name: pluginName},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		opener = new(endpointfakes.FakePluginOpener)
+		opener.OpenStub = func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+			return &plugin.Plugin{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.Write([]byte(name))
+				}),
+			}, nil
+		}
+		router = New(opener)
+	})
+
+	AfterEach(func() {
+		router.Close()
+	})
+
+	Context("when no endpoints are applied", func() {
+		It("should respond with not found", func() {
+			req, err := http.NewRequest("GET", "http://aker.me/", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			Ω(rr.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when endpoints are applied", func() {
+		BeforeEach(func() {
+			err := router.Apply([]config.Endpoint{
+				endpointCfg("/", "root"),
+				endpointCfg("/api/", "api"),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should route requests by path", func() {
+			Ω(serve("/")).Should(Equal("root"))
+			Ω(serve("/api/v1")).Should(Equal("api"))
+		})
+
+		Context("with middleware", func() {
+			BeforeEach(func() {
+				tag := func(tag string) Middleware {
+					return func(id string, h http.Handler) http.Handler {
+						return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+							w.Write([]byte(tag + id + " "))
+							h.ServeHTTP(w, req)
+						})
+					}
+				}
+				router.Close()
+				router = New(opener, tag("first:"), tag("second:"))
+				err := router.Apply([]config.Endpoint{endpointCfg("/api/", "api")})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should wrap the endpoints, the first middleware outermost", func() {
+				Ω(serve("/api/v1")).Should(Equal("first:/api/ second:/api/ api"))
+			})
+		})
+
+		It("should report the endpoints ordered by ID", func() {
+			endpoints := router.Endpoints()
+			Ω(endpoints).Should(HaveLen(2))
+			Ω(endpoints[0].ID).Should(Equal("/"))
+			Ω(endpoints[1].ID).Should(Equal("/api/"))
+			Ω(endpoints[1].Plugins[0].Name).Should(Equal("api"))
+		})
+
+		It("should drain and resume an endpoint", func() {
+			Ω(router.Drain("/api/")).Should(Succeed())
+			Ω(serve("/api/v1")).ShouldNot(Equal("api"))
+			Ω(serve("/")).Should(Equal("root"))
+
+			Ω(router.Resume("/api/")).Should(Succeed())
+			Ω(serve("/api/v1")).Should(Equal("api"))
+		})
+
+		It("should reject unknown endpoints", func() {
+			Ω(router.Drain("/unknown")).Should(Equal(UnknownEndpointError("/unknown")))
+			Ω(router.RestartPlugin("/unknown", 0)).Should(Equal(UnknownEndpointError("/unknown")))
+		})
+
+		Context("and then the same endpoints are applied again", func() {
+			BeforeEach(func() {
+				err := router.Apply([]config.Endpoint{
+					endpointCfg("/", "root"),
+					endpointCfg("/api/", "api"),
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should not reopen any plugins", func() {
+				Ω(opener.OpenCallCount()).Should(Equal(2))
+			})
+		})
+
+		Context("and then a changed set of endpoints is applied", func() {
+			BeforeEach(func() {
+				err := router.Apply([]config.Endpoint{
+					endpointCfg("/", "root"),
+					endpointCfg("/api/", "new-api"),
+					endpointCfg("/admin", "admin"),
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should open only the new and changed endpoints", func() {
+				Ω(opener.OpenCallCount()).Should(Equal(4))
+				name, _, _, _ := opener.OpenArgsForCall(2)
+				Ω(name).Should(Equal("new-api"))
+				name, _, _, _ = opener.OpenArgsForCall(3)
+				Ω(name).Should(Equal("admin"))
+			})
+
+			It("should route requests through the new endpoints", func() {
+				Ω(serve("/")).Should(Equal("root"))
+				Ω(serve("/api/v1")).Should(Equal("new-api"))
+				Ω(serve("/admin")).Should(Equal("admin"))
+			})
+		})
+
+		Context("and then endpoints with a duplicate path are applied", func() {
+			var err error
+
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{
+					endpointCfg("/admin", "admin"),
+					endpointCfg("/admin", "other-admin"),
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(DuplicateEndpointError("/admin")))
+			})
+
+			It("should keep serving the previous endpoints", func() {
+				Ω(serve("/api/v1")).Should(Equal("api"))
+				Ω(serve("/admin")).Should(Equal("root"))
+			})
+		})
+
+		Context("and then an endpoint fails to open", func() {
+			var err error
+
+			BeforeEach(func() {
+				opener.OpenReturns(nil, errors.New("unable to open plugin"))
+				err = router.Apply([]config.Endpoint{
+					endpointCfg("/", "root"),
+					endpointCfg("/api/", "broken"),
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("should keep serving the previous endpoints", func() {
+				Ω(serve("/")).Should(Equal("root"))
+				Ω(serve("/api/v1")).Should(Equal("api"))
+			})
+		})
+	})
+
+	Context("when endpoints with hosts are applied", func() {
+		var err error
+
+		BeforeEach(func() {
+			err = router.Apply([]config.Endpoint{
+				endpointCfg("/", "default"),
+				hostEndpointCfg([]string{"example.com"}, "/", "example"),
+				hostEndpointCfg([]string{"example.com"}, "/api/", "example-api"),
+				hostEndpointCfg([]string{"*.example.com"}, "/", "any-example"),
+				hostEndpointCfg([]string{"*.eu.example.com"}, "/", "eu-example"),
+				hostEndpointCfg([]string{"Other.ORG", "other.net"}, "/api/", "other-api"),
+			})
+		})
+
+		It("should not return an error", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should route requests by exact host first", func() {
+			Ω(serveHost("example.com", "/api/v1").Body.String()).Should(Equal("example-api"))
+			Ω(serveHost("example.com:8080", "/index.html").Body.String()).Should(Equal("example"))
+			Ω(serveHost("other.org", "/api/v1").Body.String()).Should(Equal("other-api"))
+			Ω(serveHost("other.net.", "/api/v1").Body.String()).Should(Equal("other-api"))
+		})
+
+		It("should route requests by the most specific wildcard host second", func() {
+			Ω(serveHost("www.example.com", "/api/v1").Body.String()).Should(Equal("any-example"))
+			Ω(serveHost("shop.eu.example.com", "/").Body.String()).Should(Equal("eu-example"))
+		})
+
+		It("should route requests for other hosts to the endpoints without hosts", func() {
+			Ω(serveHost("aker.me", "/api/v1").Body.String()).Should(Equal("default"))
+		})
+
+		It("should not fall back to other hosts when no path matches", func() {
+			Ω(serveHost("other.org", "/").Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should redirect to the subtree of a path", func() {
+			rr := serveHost("other.org", "/api")
+			Ω(rr.Code).Should(Equal(http.StatusMovedPermanently))
+			Ω(rr.Header().Get("Location")).Should(Equal("/api/"))
+		})
+
+		It("should redirect to the clean path", func() {
+			rr := serveHost("other.org", "/api/../secret")
+			Ω(rr.Code).Should(Equal(http.StatusMovedPermanently))
+			Ω(rr.Header().Get("Location")).Should(Equal("/secret"))
+		})
+
+		It("should identify the endpoints by hosts and path", func() {
+			var ids []string
+			for _, status := range router.Endpoints() {
+				ids = append(ids, status.ID)
+			}
+			Ω(ids).Should(ConsistOf(
+				"/", "example.com/", "example.com/api/", "*.example.com/",
+				"*.eu.example.com/", "other.net,other.org/api/",
+			))
+		})
+
+		Context("and then endpoints sharing a host and path are applied", func() {
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{
+					hostEndpointCfg([]string{"a.org", "b.org"}, "/", "first"),
+					hostEndpointCfg([]string{"b.org"}, "/", "second"),
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(DuplicateEndpointError("b.org/")))
+			})
+
+			It("should not open any plugins", func() {
+				Ω(opener.OpenCallCount()).Should(Equal(6))
+			})
+		})
+
+		Context("and then an endpoint with an invalid host is applied", func() {
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{
+					hostEndpointCfg([]string{"www.*.org"}, "/", "invalid"),
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(InvalidHostError("www.*.org")))
+			})
+		})
+	})
+
+	Context("when endpoints with match rules are applied", func() {
+		var err error
+		var received *http.Request
+
+		request := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(method, "http://aker.me"+target, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			for name, values := range header {
+				req.Header[name] = values
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		BeforeEach(func() {
+			opener.OpenStub = func(name string, _ []byte, _ *plugin.Plugin, _ plugin.Options) (*plugin.Plugin, error) {
+				return &plugin.Plugin{
+					Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						received = req
+						w.Write([]byte(name))
+					}),
+				}, nil
+			}
+
+			withMatch := func(cfg config.Endpoint, match config.Match) config.Endpoint {
+				cfg.Match = match
+				return cfg
+			}
+			err = router.Apply([]config.Endpoint{
+				endpointCfg("/api/", "api"),
+				withMatch(endpointCfg("/api/", "validate"), config.Match{Methods: []string{"post", "PUT"}}),
+				withMatch(endpointCfg("/api/", "strict-validate"), config.Match{
+					Methods: []string{"POST"},
+					Headers: map[string]string{"content-type": "application/json"},
+				}),
+				withMatch(endpointCfg("/api/", "debug"), config.Match{Query: map[string]string{"debug": "*"}}),
+				endpointCfg("/users/{id}/orders/{order}", "order"),
+				endpointCfg("/users/{id}/", "user"),
+				endpointCfg("/users/me/", "me"),
+				config.Endpoint{
+					PathRegex: `/v(?P<version>[0-9]+)/.*`,
+					Plugins:   []config.PluginReference{{Name: "versioned"}},
+				},
+			})
+		})
+
+		It("should not return an error", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should route requests by method", func() {
+			Ω(request("GET", "/api/items", nil).Body.String()).Should(Equal("api"))
+			Ω(request("PUT", "/api/items", nil).Body.String()).Should(Equal("validate"))
+		})
+
+		It("should prefer the endpoint with the most predicates", func() {
+			header := http.Header{"Content-Type": {"application/json"}}
+			Ω(request("POST", "/api/items", header).Body.String()).Should(Equal("strict-validate"))
+			Ω(request("POST", "/api/items", nil).Body.String()).Should(Equal("validate"))
+		})
+
+		It("should route requests by query parameter", func() {
+			Ω(request("GET", "/api/items?debug=1", nil).Body.String()).Should(Equal("debug"))
+		})
+
+		It("should pass path template parameters as headers", func() {
+			Ω(request("GET", "/users/42/orders/7", nil).Body.String()).Should(Equal("order"))
+			Ω(received.Header.Get("X-Aker-Param-Id")).Should(Equal("42"))
+			Ω(received.Header.Get("X-Aker-Param-Order")).Should(Equal("7"))
+		})
+
+		It("should match template subtrees", func() {
+			Ω(request("GET", "/users/42/profile", nil).Body.String()).Should(Equal("user"))
+			Ω(request("GET", "/users/42/orders/7/items", nil).Body.String()).Should(Equal("user"))
+		})
+
+		It("should prefer literal paths over templates", func() {
+			Ω(request("GET", "/users/me/profile", nil).Body.String()).Should(Equal("me"))
+		})
+
+		It("should pass named groups of path regexes as headers", func() {
+			Ω(request("GET", "/v2/items", nil).Body.String()).Should(Equal("versioned"))
+			Ω(received.Header.Get("X-Aker-Param-Version")).Should(Equal("2"))
+		})
+
+		It("should match path regexes against the whole path", func() {
+			Ω(request("GET", "/x/v2/items", nil).Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should remove parameter headers sent by the client", func() {
+			header := http.Header{"X-Aker-Param-Id": {"forged"}, "X-Aker-Param-Admin": {"true"}}
+			request("GET", "/users/42/profile", header)
+			Ω(received.Header.Get("X-Aker-Param-Id")).Should(Equal("42"))
+			Ω(received.Header).ShouldNot(HaveKey("X-Aker-Param-Admin"))
+		})
+
+		It("should identify the endpoints by path and predicates", func() {
+			var ids []string
+			for _, status := range router.Endpoints() {
+				ids = append(ids, status.ID)
+			}
+			Ω(ids).Should(ContainElement("/api/ methods=POST,PUT"))
+			Ω(ids).Should(ContainElement("/api/ methods=POST header:Content-Type=application/json"))
+			Ω(ids).Should(ContainElement("/api/ query:debug=*"))
+			Ω(ids).Should(ContainElement("~/v(?P<version>[0-9]+)/.*"))
+		})
+
+		Context("and then endpoints of different files with the same path are applied", func() {
+			BeforeEach(func() {
+				first := endpointCfg("/", "first")
+				first.Source = "a.yml"
+				second := endpointCfg("/", "second")
+				second.Source = "b.yml"
+				err = router.Apply([]config.Endpoint{first, second})
+			})
+
+			It("should return an error naming both files", func() {
+				Ω(err).Should(MatchError(`endpoint of "b.yml": duplicate endpoint: "/", already defined in "a.yml"`))
+			})
+		})
+
+		Context("and then path templates differing only in parameter names are applied", func() {
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{
+					endpointCfg("/u/{id}", "by-id"),
+					endpointCfg("/u/{name}", "by-name"),
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(DuplicateEndpointError("/u/{name}")))
+			})
+		})
+
+		Context("and then a path regex matching the same paths as a template is applied", func() {
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{
+					endpointCfg("/u/{id}", "by-id"),
+					config.Endpoint{
+						PathRegex: `/u/(?P<user>[^/]+)`,
+						Plugins:   []config.PluginReference{{Name: "by-regex"}},
+					},
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(DuplicateEndpointError("~/u/(?P<user>[^/]+)")))
+			})
+		})
+
+		Context("and then an endpoint with an invalid path template is applied", func() {
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{endpointCfg("/users/{id", "broken")})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(InvalidPathTemplateError("/users/{id")))
+			})
+		})
+
+		Context("and then an endpoint with an invalid path regex is applied", func() {
+			BeforeEach(func() {
+				err = router.Apply([]config.Endpoint{
+					config.Endpoint{
+						PathRegex: "^/(",
+						Plugins:   []config.PluginReference{{Name: "broken"}},
+					},
+				})
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(BeAssignableToTypeOf(&InvalidPathRegexError{}))
+			})
+
+			It("should report the expression as it was configured", func() {
+				Ω(err.Error()).Should(Equal("invalid endpoint path regex \"^/(\": error parsing regexp: missing closing ): `^/(`"))
+			})
+		})
+	})
+
+	Context("when endpoints with the same chain are applied through a pool", func() {
+		chainCfg := func(path string) config.Endpoint {
+			return config.Endpoint{
+				Path: path,
+				Plugins: []config.PluginReference{
+					{Use: "auth", Name: "auth"},
+					{Name: "proxy"},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			router = New(plugin.NewPool(opener))
+			Ω(router.Apply([]config.Endpoint{chainCfg("/a/"), chainCfg("/b/")})).Should(Succeed())
+		})
+
+		It("should open the plugins of the chain once", func() {
+			Ω(opener.OpenCallCount()).Should(Equal(2))
+			Ω(serve("/a/")).Should(Equal("auth"))
+			Ω(serve("/b/")).Should(Equal("auth"))
+		})
+
+		It("should keep sharing the plugins when one of the endpoints is changed", func() {
+			changed := chainCfg("/b/")
+			changed.Plugins[1].Name = "other-proxy"
+			Ω(router.Apply([]config.Endpoint{chainCfg("/a/"), changed})).Should(Succeed())
+			Ω(opener.OpenCallCount()).Should(Equal(4))
+
+			Ω(router.Apply([]config.Endpoint{chainCfg("/a/"), chainCfg("/b/")})).Should(Succeed())
+			Ω(opener.OpenCallCount()).Should(Equal(4))
+		})
+	})
+
+	Context("when the router is closed", func() {
+		BeforeEach(func() {
+			router.Close()
+		})
+
+		It("should not open any endpoints", func() {
+			err := router.Apply([]config.Endpoint{endpointCfg("/api/", "api")})
+			Ω(err).Should(Equal(ClosedErr))
+			Ω(opener.OpenCallCount()).Should(BeZero())
+		})
+	})
+
+	Describe("Validate", func() {
+		It("should return no errors for valid endpoints", func() {
+			Ω(Validate([]config.Endpoint{
+				endpointCfg("/", "first"),
+				hostEndpointCfg([]string{"example.com"}, "/", "second"),
+			})).Should(BeEmpty())
+		})
+
+		It("should return the errors of all invalid endpoints", func() {
+			Ω(Validate([]config.Endpoint{
+				endpointCfg("/", "first"),
+				endpointCfg("/", "second"),
+				endpointCfg("/users/{id", "third"),
+				hostEndpointCfg([]string{"a.*.com"}, "/", "fourth"),
+			})).Should(Equal([]error{
+				&EndpointError{Index: 1, Err: DuplicateEndpointError("/")},
+				&EndpointError{Index: 2, Err: InvalidPathTemplateError("/users/{id")},
+				&EndpointError{Index: 3, Err: InvalidHostError("a.*.com")},
+			}))
+		})
+
+		It("should name the files of endpoints conflicting across files", func() {
+			first := endpointCfg("/", "first")
+			first.Source = "a.yml"
+			second := endpointCfg("/", "second")
+			second.Source = "b.yml"
+			Ω(Validate([]config.Endpoint{first, second})).Should(Equal([]error{
+				&EndpointError{Index: 1, Source: "b.yml", Err: &ConflictingEndpointError{ID: "/", Source: "a.yml"}},
+			}))
+		})
+
+		It("should not open any plugins", func() {
+			Validate([]config.Endpoint{endpointCfg("/", "first")})
+			Ω(opener.OpenCallCount()).Should(Equal(0))
+		})
+	})
+})
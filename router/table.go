@@ -0,0 +1,228 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/SAP/aker/config"
+)
+
+// table is an immutable routing table. It selects the endpoints of the
+// request's host first and the endpoint matching the request best among them
+// second. That is the one with the most specific path, then the one with
+// the most predicates, and then the one configured first.
+//
+// Hosts are matched exactly first, by the most specific wildcard second,
+// and requests for hosts that are not configured anywhere go to the
+// endpoints without hosts. Requests do not fall back to less specific hosts
+// when none of their host's paths matches, so the "/" endpoint of a host is
+// its default.
+type table struct {
+	exact     map[string]*routes
+	wildcards []wildcardRoutes
+	fallback  *routes
+	// size is the number of endpoints added.
+	size int
+}
+
+type wildcardRoutes struct {
+	// suffix is the wildcard without the leading "*", e.g. ".example.com".
+	suffix string
+	routes *routes
+}
+
+// routes are the endpoints of a host, ordered from the best match to the
+// worst one.
+type routes struct {
+	entries []route
+}
+
+type route struct {
+	matcher *matcher
+	handler http.Handler
+	// order is the position of the endpoint in the configuration.
+	order int
+	// source is the configuration file of the endpoint.
+	source string
+}
+
+// before reports whether the route should be tried before the other one.
+func (r route) before(other route) bool {
+	if r.matcher.score != other.matcher.score {
+		return r.matcher.score > other.matcher.score
+	}
+	// literal paths are more specific than patterns of the same score
+	if literal, otherLiteral := r.matcher.path == nil, other.matcher.path == nil; literal != otherLiteral {
+		return literal
+	}
+	if r.matcher.predicates() != other.matcher.predicates() {
+		return r.matcher.predicates() > other.matcher.predicates()
+	}
+	return r.order < other.order
+}
+
+func newTable() *table {
+	return &table{
+		exact:    make(map[string]*routes),
+		fallback: &routes{},
+	}
+}
+
+// add registers the handler of the endpoint on all of its hosts, or as
+// a fallback when it has none.
+func (t *table) add(endpointCfg config.Endpoint, handler http.Handler) error {
+	m, err := newMatcher(endpointCfg)
+	if err != nil {
+		return err
+	}
+	entry := route{matcher: m, handler: handler, order: t.size, source: endpointCfg.Source}
+	t.size++
+
+	if len(endpointCfg.Hosts) == 0 {
+		return t.fallback.add(entry, m.key)
+	}
+	for _, host := range endpointCfg.Hosts {
+		host = normalizeHost(host)
+		hostRoutes, err := t.routesOf(host)
+		if err != nil {
+			return err
+		}
+		if err := hostRoutes.add(entry, host+m.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *table) routesOf(host string) (*routes, error) {
+	if !strings.HasPrefix(host, "*") {
+		if host == "" || strings.Contains(host, "*") {
+			return nil, InvalidHostError(host)
+		}
+		if _, ok := t.exact[host]; !ok {
+			t.exact[host] = &routes{}
+		}
+		return t.exact[host], nil
+	}
+
+	suffix := host[1:]
+	if !strings.HasPrefix(suffix, ".") || len(suffix) < 2 || strings.Contains(suffix, "*") {
+		return nil, InvalidHostError(host)
+	}
+	for _, wildcard := range t.wildcards {
+		if wildcard.suffix == suffix {
+			return wildcard.routes, nil
+		}
+	}
+	wildcard := wildcardRoutes{suffix: suffix, routes: &routes{}}
+	t.wildcards = append(t.wildcards, wildcard)
+	sort.SliceStable(t.wildcards, func(i, j int) bool {
+		return len(t.wildcards[i].suffix) > len(t.wildcards[j].suffix)
+	})
+	return wildcard.routes, nil
+}
+
+func (r *routes) add(entry route, id string) error {
+	for _, existing := range r.entries {
+		if existing.matcher.route != entry.matcher.route {
+			continue
+		}
+		if existing.source != entry.source {
+			return &ConflictingEndpointError{ID: id, Source: existing.source}
+		}
+		return DuplicateEndpointError(id)
+	}
+	r.entries = append(r.entries, entry)
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		return r.entries[i].before(r.entries[j])
+	})
+	return nil
+}
+
+// match returns the handler of the best route matching the request with the
+// specified path, along with the parameters extracted from the path.
+func (r *routes) match(req *http.Request, path string) (http.Handler, map[string]string) {
+	for _, entry := range r.entries {
+		if params, ok := entry.matcher.match(req, path); ok {
+			return entry.handler, params
+		}
+	}
+	return nil, nil
+}
+
+// routesFor returns the routes serving the host.
+func (t *table) routesFor(host string) *routes {
+	host = normalizeHost(host)
+	if hostRoutes, ok := t.exact[host]; ok {
+		return hostRoutes
+	}
+	for _, wildcard := range t.wildcards {
+		if strings.HasSuffix(host, wildcard.suffix) && len(host) > len(wildcard.suffix) {
+			return wildcard.routes
+		}
+	}
+	return t.fallback
+}
+
+func (t *table) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "CONNECT" {
+		if cleaned := cleanPath(req.URL.Path); cleaned != req.URL.Path {
+			redirect(w, req, cleaned)
+			return
+		}
+	}
+
+	hostRoutes := t.routesFor(req.Host)
+	if handler, params := hostRoutes.match(req, req.URL.Path); handler != nil {
+		setParams(req.Header, params)
+		handler.ServeHTTP(w, req)
+		return
+	}
+	// like http.ServeMux, redirect to the subtree when only that is routed
+	if handler, _ := hostRoutes.match(req, req.URL.Path+"/"); handler != nil && !strings.HasSuffix(req.URL.Path, "/") {
+		redirect(w, req, req.URL.Path+"/")
+		return
+	}
+	http.NotFound(w, req)
+}
+
+func pathMatches(pattern, path string) bool {
+	if !strings.HasSuffix(pattern, "/") {
+		return pattern == path
+	}
+	return strings.HasPrefix(path, pattern)
+}
+
+// normalizeHost strips the port and the trailing dot of a fully qualified
+// name and lowers the case.
+func normalizeHost(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// cleanPath returns the canonical form of the path the same way
+// http.ServeMux does.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := path.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func redirect(w http.ResponseWriter, req *http.Request, target string) {
+	u := url.URL{Path: target, RawQuery: req.URL.RawQuery}
+	http.Redirect(w, req, u.String(), http.StatusMovedPermanently)
+}
@@ -0,0 +1,15 @@
+package socket
+
+// DialError is reported by ObservedProxyHTTP when connecting to the socket
+// fails.
+type DialError struct {
+	Err error
+}
+
+func (e *DialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
@@ -1,6 +1,7 @@
 package socket
 
 import (
+	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -13,6 +14,17 @@ const flushInterval = 300 * time.Millisecond
 
 // ProxyHTTP proxies all requests to the specified socket path.
 func ProxyHTTP(socketPath string) http.Handler {
+	return ObservedProxyHTTP(socketPath, nil)
+}
+
+// ObservedProxyHTTP is like ProxyHTTP, but calls onError, when not nil, with
+// each request that fails on the way to or from the socket, e.g. because the
+// server behind it closes the connection without responding. If connecting
+// to the socket fails even after retrying, the error is a *DialError. The
+// requests that fail after they have been canceled or their deadline has
+// passed are not reported. The request passed is the one sent to the
+// socket, which has the context of the incoming request.
+func ObservedProxyHTTP(socketPath string, onError func(*http.Request, error)) http.Handler {
 	return &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
 			req.URL.Scheme = "http"
@@ -30,10 +42,17 @@ func ProxyHTTP(socketPath string) http.Handler {
 						time.Sleep(retryInterval)
 					}
 				}
-				return nil, err
+				return nil, &DialError{Err: err}
 			},
 			ExpectContinueTimeout: 1 * time.Second,
 		},
 		FlushInterval: flushInterval,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if onError != nil && req.Context().Err() == nil {
+				onError(req, err)
+			}
+			log.Printf("http: proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
 	}
 }
@@ -2,6 +2,7 @@ package socket_test
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 
@@ -45,4 +46,80 @@ var _ = Describe("Proxy", func() {
 		Ω(respRecorder.Body.Bytes()).Should(Equal(payload))
 	})
 
+	Context("when observed", func() {
+		var observedPath string
+		var reported []error
+
+		BeforeEach(func() {
+			observedPath = path
+			reported = nil
+		})
+
+		JustBeforeEach(func() {
+			proxyHandler = ObservedProxyHTTP(observedPath, func(_ *http.Request, err error) {
+				reported = append(reported, err)
+			})
+		})
+
+		serve := func(ctx context.Context) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", "http://whatsoever", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			respRecorder := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(respRecorder, req.WithContext(ctx))
+			return respRecorder
+		}
+
+		Context("and the socket cannot be dialed", func() {
+			BeforeEach(func() {
+				observedPath = path + ".missing"
+			})
+
+			It("should report the dial error", func() {
+				Ω(serve(context.Background()).Code).Should(Equal(http.StatusBadGateway))
+				Ω(reported).Should(HaveLen(1))
+				Ω(reported[0]).Should(BeAssignableToTypeOf(&DialError{}))
+			})
+		})
+
+		Context("and the server closes the connection after reading the request", func() {
+			BeforeEach(func() {
+				Ω(socketServer.Stop()).Should(Succeed())
+				socketServer = NewHTTPServer(path, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Ω(err).ShouldNot(HaveOccurred())
+					conn.Close()
+				}))
+				Ω(socketServer.Start()).Should(Succeed())
+			})
+
+			It("should report the error", func() {
+				Ω(serve(context.Background()).Code).Should(Equal(http.StatusBadGateway))
+				Ω(reported).Should(HaveLen(1))
+				Ω(reported[0]).ShouldNot(BeAssignableToTypeOf(&DialError{}))
+			})
+
+			It("should not report requests that were canceled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				Ω(serve(ctx).Code).Should(Equal(http.StatusBadGateway))
+				Ω(reported).Should(BeEmpty())
+			})
+		})
+
+		Context("and the server responds with an error", func() {
+			BeforeEach(func() {
+				Ω(socketServer.Stop()).Should(Succeed())
+				socketServer = NewHTTPServer(path, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(http.StatusBadGateway)
+				}))
+				Ω(socketServer.Start()).Should(Succeed())
+			})
+
+			It("should pass the response on without reporting it", func() {
+				Ω(serve(context.Background()).Code).Should(Equal(http.StatusBadGateway))
+				Ω(reported).Should(BeEmpty())
+			})
+		})
+	})
+
 })
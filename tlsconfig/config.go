@@ -0,0 +1,160 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+
+	"github.com/SAP/aker/config"
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// DefaultMinVersion is used when the configuration does not specify one.
+const DefaultMinVersion = tls.VersionTLS12
+
+// New creates a tls.Config based on the provided configuration.
+//
+// All configured certificates are loaded. The certificate presented to a
+// client is the one whose names match the server name requested via SNI,
+// with exact names taking precedence over wildcard ones. The first
+// certificate is used when none matches.
+func New(cfg config.TLSConfig) (*tls.Config, error) {
+	if len(cfg.Certificates) == 0 {
+		return nil, NoCertificatesErr
+	}
+
+	store := &certificateStore{
+		names: make(map[string]*tls.Certificate),
+	}
+	for _, certCfg := range cfg.Certificates {
+		cert, err := tls.LoadX509KeyPair(certCfg.CertFile, certCfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.add(cert); err != nil {
+			return nil, err
+		}
+	}
+
+	minVersion, err := parseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: store.get,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+	}
+	if cfg.ClientCA != "" {
+		if err := configureClientAuth(tlsConfig, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return tlsConfig, nil
+}
+
+type certificateStore struct {
+	fallback *tls.Certificate
+	names    map[string]*tls.Certificate
+}
+
+func (s *certificateStore) add(cert tls.Certificate) error {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+
+	if s.fallback == nil {
+		s.fallback = &cert
+	}
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		// the first certificate specifying a name wins
+		if _, ok := s.names[name]; !ok {
+			s.names[name] = &cert
+		}
+	}
+	return nil
+}
+
+func (s *certificateStore) get(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := s.names[name]; ok {
+		return cert, nil
+	}
+	if dot := strings.IndexByte(name, '.'); dot > 0 {
+		if cert, ok := s.names["*"+name[dot:]]; ok {
+			return cert, nil
+		}
+	}
+	return s.fallback, nil
+}
+
+func parseVersion(version string) (uint16, error) {
+	if version == "" {
+		return DefaultMinVersion, nil
+	}
+	value, ok := versions[version]
+	if !ok {
+		return 0, UnsupportedVersionError(version)
+	}
+	return value, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := ids[name]
+		if !ok {
+			return nil, UnsupportedCipherSuiteError(name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+func configureClientAuth(tlsConfig *tls.Config, cfg config.TLSConfig) error {
+	switch cfg.ClientAuth {
+	case "", "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return UnsupportedClientAuthError(cfg.ClientAuth)
+	}
+
+	data, err := ioutil.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return InvalidClientCAErr
+	}
+	tlsConfig.ClientCAs = pool
+	return nil
+}
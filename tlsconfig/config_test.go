@@ -0,0 +1,178 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/SAP/aker/config"
+	. "github.com/SAP/aker/tlsconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("New", func() {
+
+	var dir string
+	var ca *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	var caFile string
+
+	var cfg config.TLSConfig
+	var tlsConfig *tls.Config
+	var err error
+
+	BeforeEach(func() {
+		dir = tempDir()
+		ca, caKey, caFile, _ = generateCertificate(dir, "ca", nil, nil)
+		_, _, certA, keyA := generateCertificate(dir, "a", ca, caKey, "a.example.com")
+		_, _, certB, keyB := generateCertificate(dir, "b", ca, caKey, "*.b.example.com", "b.example.com")
+		cfg = config.TLSConfig{
+			Certificates: []config.CertificateConfig{
+				{CertFile: certA, KeyFile: keyA},
+				{CertFile: certB, KeyFile: keyB},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	JustBeforeEach(func() {
+		tlsConfig, err = New(cfg)
+	})
+
+	Context("when the configuration is valid", func() {
+		It("should not return an error", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should default the minimum version to TLS 1.2", func() {
+			Ω(tlsConfig.MinVersion).Should(Equal(uint16(tls.VersionTLS12)))
+		})
+
+		It("should not require client certificates", func() {
+			Ω(tlsConfig.ClientAuth).Should(Equal(tls.NoClientCert))
+		})
+
+		DescribeTable("certificate selection", func(serverName, expectedName string) {
+			cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cert.Leaf.Subject.CommonName).Should(Equal(expectedName))
+		},
+			Entry("exact name", "a.example.com", "a"),
+			Entry("exact name with different case", "A.Example.COM", "a"),
+			Entry("exact name of second certificate", "b.example.com", "b"),
+			Entry("wildcard name", "api.b.example.com", "b"),
+			Entry("nested subdomain is not matched by wildcard", "x.api.b.example.com", "a"),
+			Entry("unknown name falls back to first certificate", "unknown.org", "a"),
+			Entry("no SNI falls back to first certificate", "", "a"),
+		)
+	})
+
+	Context("when no certificates are specified", func() {
+		BeforeEach(func() {
+			cfg.Certificates = nil
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(Equal(NoCertificatesErr))
+		})
+	})
+
+	Context("when a certificate file does not exist", func() {
+		BeforeEach(func() {
+			cfg.Certificates[0].CertFile = "/not/existing"
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when a minimum version is specified", func() {
+		BeforeEach(func() {
+			cfg.MinVersion = "1.3"
+		})
+
+		It("should use it", func() {
+			Ω(tlsConfig.MinVersion).Should(Equal(uint16(tls.VersionTLS13)))
+		})
+	})
+
+	Context("when an unknown minimum version is specified", func() {
+		BeforeEach(func() {
+			cfg.MinVersion = "2.0"
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(Equal(UnsupportedVersionError("2.0")))
+		})
+	})
+
+	Context("when cipher suites are specified", func() {
+		BeforeEach(func() {
+			cfg.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+		})
+
+		It("should use them", func() {
+			Ω(tlsConfig.CipherSuites).Should(Equal([]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}))
+		})
+	})
+
+	Context("when an unknown cipher suite is specified", func() {
+		BeforeEach(func() {
+			cfg.CipherSuites = []string{"TLS_NOT_A_SUITE"}
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(Equal(UnsupportedCipherSuiteError("TLS_NOT_A_SUITE")))
+		})
+	})
+
+	Context("when a client CA is specified", func() {
+		BeforeEach(func() {
+			cfg.ClientCA = caFile
+		})
+
+		It("should require and verify client certificates", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tlsConfig.ClientAuth).Should(Equal(tls.RequireAndVerifyClientCert))
+			Ω(tlsConfig.ClientCAs).ShouldNot(BeNil())
+		})
+
+		Context("and client auth is optional", func() {
+			BeforeEach(func() {
+				cfg.ClientAuth = "optional"
+			})
+
+			It("should verify client certificates if given", func() {
+				Ω(tlsConfig.ClientAuth).Should(Equal(tls.VerifyClientCertIfGiven))
+			})
+		})
+
+		Context("and client auth mode is unknown", func() {
+			BeforeEach(func() {
+				cfg.ClientAuth = "sometimes"
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(Equal(UnsupportedClientAuthError("sometimes")))
+			})
+		})
+	})
+
+	Context("when the client CA file has no certificates", func() {
+		BeforeEach(func() {
+			cfg.ClientCA = cfg.Certificates[0].KeyFile
+		})
+
+		It("should return an error", func() {
+			Ω(err).Should(Equal(InvalidClientCAErr))
+		})
+	})
+})
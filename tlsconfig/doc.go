@@ -0,0 +1,3 @@
+// Package tlsconfig builds the TLS configuration of Aker's front listener and
+// exposes the identity of verified client certificates to plugins.
+package tlsconfig
@@ -0,0 +1,28 @@
+package tlsconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+type UnsupportedVersionError string
+
+func (e UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported TLS version: %q", string(e))
+}
+
+type UnsupportedCipherSuiteError string
+
+func (e UnsupportedCipherSuiteError) Error() string {
+	return fmt.Sprintf("unsupported cipher suite: %q", string(e))
+}
+
+type UnsupportedClientAuthError string
+
+func (e UnsupportedClientAuthError) Error() string {
+	return fmt.Sprintf("unsupported client auth mode: %q", string(e))
+}
+
+var NoCertificatesErr = errors.New("no TLS certificates specified")
+
+var InvalidClientCAErr = errors.New("no CA certificates found in client CA file")
@@ -0,0 +1,56 @@
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// ClientCertHeaderPrefix is the prefix of all request headers that carry
+// information about the verified client certificate. Headers with this
+// prefix are reserved by Aker and are never accepted from clients.
+const ClientCertHeaderPrefix = "X-Aker-Client-Cert-"
+
+// Headers describing the verified client certificate.
+const (
+	ClientCertSubjectHeader     = ClientCertHeaderPrefix + "Subject"
+	ClientCertIssuerHeader      = ClientCertHeaderPrefix + "Issuer"
+	ClientCertSerialHeader      = ClientCertHeaderPrefix + "Serial"
+	ClientCertFingerprintHeader = ClientCertHeaderPrefix + "Fingerprint"
+	ClientCertDNSNamesHeader    = ClientCertHeaderPrefix + "Dns-Names"
+	ClientCertEmailsHeader      = ClientCertHeaderPrefix + "Emails"
+)
+
+// ClientIdentityHandler returns a http.Handler which removes any reserved
+// client certificate headers sent by the client and, if the client presented
+// a certificate that was verified, sets them to describe that certificate
+// before calling h.
+//
+// The fingerprint is the hex encoded SHA-256 digest of the DER encoded
+// certificate.
+func ClientIdentityHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for name := range req.Header {
+			if strings.HasPrefix(name, ClientCertHeaderPrefix) {
+				req.Header.Del(name)
+			}
+		}
+
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			cert := req.TLS.VerifiedChains[0][0]
+			fingerprint := sha256.Sum256(cert.Raw)
+			req.Header.Set(ClientCertSubjectHeader, cert.Subject.String())
+			req.Header.Set(ClientCertIssuerHeader, cert.Issuer.String())
+			req.Header.Set(ClientCertSerialHeader, cert.SerialNumber.String())
+			req.Header.Set(ClientCertFingerprintHeader, hex.EncodeToString(fingerprint[:]))
+			if len(cert.DNSNames) > 0 {
+				req.Header.Set(ClientCertDNSNamesHeader, strings.Join(cert.DNSNames, ","))
+			}
+			if len(cert.EmailAddresses) > 0 {
+				req.Header.Set(ClientCertEmailsHeader, strings.Join(cert.EmailAddresses, ","))
+			}
+		}
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,68 @@
+package tlsconfig_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/SAP/aker/tlsconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClientIdentityHandler", func() {
+
+	var dir string
+	var clientCert *x509.Certificate
+
+	var req *http.Request
+	var received http.Header
+
+	BeforeEach(func() {
+		dir = tempDir()
+		ca, caKey, _, _ := generateCertificate(dir, "ca", nil, nil)
+		clientCert, _, _, _ = generateCertificate(dir, "client", ca, caKey, "client.example.com")
+
+		var err error
+		req, err = http.NewRequest("GET", "https://aker.me/", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		req.Header.Set(ClientCertSubjectHeader, "CN=spoofed")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	JustBeforeEach(func() {
+		handler := ClientIdentityHandler(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			received = req.Header
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	Context("when the request was not made over TLS", func() {
+		It("should remove the reserved headers", func() {
+			Ω(received).ShouldNot(HaveKey(ClientCertSubjectHeader))
+		})
+	})
+
+	Context("when the client presented a verified certificate", func() {
+		BeforeEach(func() {
+			req.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{clientCert}},
+			}
+		})
+
+		It("should describe the certificate in the reserved headers", func() {
+			Ω(received.Get(ClientCertSubjectHeader)).Should(Equal("CN=client"))
+			Ω(received.Get(ClientCertIssuerHeader)).Should(Equal("CN=ca"))
+			Ω(received.Get(ClientCertSerialHeader)).Should(Equal(clientCert.SerialNumber.String()))
+			Ω(received.Get(ClientCertFingerprintHeader)).Should(HaveLen(64))
+			Ω(received.Get(ClientCertDNSNamesHeader)).Should(Equal("client.example.com"))
+			Ω(received).ShouldNot(HaveKey(ClientCertEmailsHeader))
+		})
+	})
+})
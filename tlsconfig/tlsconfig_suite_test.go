@@ -0,0 +1,74 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TLSConfig Suite")
+}
+
+// generateCertificate creates a certificate for the specified names signed by
+// parent, or a self-signed CA certificate if parent is nil. The PEM encoded
+// certificate and key are written to dir.
+func generateCertificate(dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, dnsNames ...string) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	Ω(err).ShouldNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(certFile, "CERTIFICATE", der)
+	writePEM(keyFile, "EC PRIVATE KEY", keyDER)
+	return cert, key, certFile, keyFile
+}
+
+func writePEM(path, blockType string, data []byte) {
+	file, err := os.Create(path)
+	Ω(err).ShouldNot(HaveOccurred())
+	defer file.Close()
+	Ω(pem.Encode(file, &pem.Block{Type: blockType, Bytes: data})).Should(Succeed())
+}
+
+func tempDir() string {
+	dir, err := ioutil.TempDir("", "aker-tls")
+	Ω(err).ShouldNot(HaveOccurred())
+	return dir
+}
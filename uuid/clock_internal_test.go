@@ -0,0 +1,49 @@
+package uuid
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("monotonicClock", func() {
+	var now time.Time
+	var clock *monotonicClock
+
+	BeforeEach(func() {
+		now = time.Unix(1500000000, 0)
+		clock = &monotonicClock{now: func() time.Time { return now }}
+	})
+
+	It("should start the counter in its lower half each millisecond", func() {
+		millis, counter := clock.next(0xffff)
+		Ω(millis).Should(Equal(uint64(1500000000000)))
+		Ω(counter).Should(Equal(uint16(0x07ff)))
+	})
+
+	It("should increment the counter within the same millisecond", func() {
+		clock.next(0x0010)
+		millis, counter := clock.next(0x0000)
+		Ω(millis).Should(Equal(uint64(1500000000000)))
+		Ω(counter).Should(Equal(uint16(0x0011)))
+	})
+
+	It("should not go back in time with the clock", func() {
+		clock.next(0x0010)
+		now = now.Add(-time.Second)
+		millis, counter := clock.next(0x0000)
+		Ω(millis).Should(Equal(uint64(1500000000000)))
+		Ω(counter).Should(Equal(uint16(0x0011)))
+	})
+
+	It("should move to the next millisecond when the counter is exhausted", func() {
+		clock.next(0x07ff)
+		for i := 0; i < 0x0800; i++ {
+			clock.next(0)
+		}
+		millis, counter := clock.next(0x0005)
+		Ω(millis).Should(Equal(uint64(1500000000001)))
+		Ω(counter).Should(Equal(uint16(0x0005)))
+	})
+})
@@ -0,0 +1,9 @@
+package uuid
+
+import "fmt"
+
+type InvalidFormatError string
+
+func (e InvalidFormatError) Error() string {
+	return fmt.Sprintf("invalid UUID format: %q", string(e))
+}
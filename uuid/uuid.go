@@ -1,29 +1,107 @@
-// Package uuid provides primitives for creating random universally unique
-// identifiers.
+// Package uuid provides primitives for creating and parsing universally
+// unique identifiers as specified by RFC 4122 and its successor RFC 9562.
 package uuid
 
 import (
 	"crypto/rand"
-	"fmt"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
 )
 
 // UUID represents a universally unique identifier
 type UUID [16]byte
 
+// Nil is the UUID with all bits set to zero.
+var Nil UUID
+
 // String returns the canonical form of the UUID.
 // The canonical form is represented by 32 lowercase hexadecimal digits,
 // displayed in five groups separated by hyphens, in the form 8-4-4-4-12.
 func (u UUID) String() string {
-	// canonical form: 8-4-4-4-12
-	return fmt.Sprintf("%x-%x-%x-%x-%x",
-		u[0:4],
-		u[4:6],
-		u[6:8],
-		u[8:10],
-		u[10:])
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Version returns the version of the UUID, e.g. 4 for random UUIDs.
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// MarshalText implements encoding.TextMarshaler. The UUID is encoded in its
+// canonical form, which makes it a string in JSON as well.
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts all forms
+// that Parse does.
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+// Parse parses a UUID in one of the following forms, regardless of case:
+//
+//	6ba7b810-9dad-11d1-80b4-00c04fd430c8
+//	urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8
+//	{6ba7b810-9dad-11d1-80b4-00c04fd430c8}
+//	6ba7b8109dad11d180b400c04fd430c8
+func Parse(s string) (UUID, error) {
+	text := s
+	switch {
+	case len(text) == 45 && strings.EqualFold(text[:9], "urn:uuid:"):
+		text = text[9:]
+	case len(text) == 38 && text[0] == '{' && text[37] == '}':
+		text = text[1:37]
+	}
+
+	var digits string
+	switch len(text) {
+	case 36:
+		if text[8] != '-' || text[13] != '-' || text[18] != '-' || text[23] != '-' {
+			return Nil, InvalidFormatError(s)
+		}
+		digits = text[0:8] + text[9:13] + text[14:18] + text[19:23] + text[24:]
+	case 32:
+		digits = text
+	default:
+		return Nil, InvalidFormatError(s)
+	}
+
+	var u UUID
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return Nil, InvalidFormatError(s)
+	}
+	return u, nil
+}
+
+// MustParse is like Parse, but panics if the UUID cannot be parsed. It is
+// meant for initializing variables with constant UUIDs.
+func MustParse(s string) UUID {
+	u, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
 }
 
-// Random generates random UUID.
+// Random generates a random, version 4 UUID.
 // It uses CSPRNG.
 func Random() (UUID, error) {
 	u := UUID{}
@@ -31,5 +109,71 @@ func Random() (UUID, error) {
 	if err != nil {
 		return UUID{}, err
 	}
+	u.setVersion(4)
+	return u, nil
+}
+
+// NewV7 generates a version 7 UUID. Its first 48 bits are the current Unix
+// time in milliseconds, so the UUIDs sort by the time of their creation.
+//
+// The 12 bits following the version are a counter, which makes the UUIDs
+// generated by a process strictly increasing even within the same
+// millisecond, or when the clock goes backwards. The rest is random.
+func NewV7() (UUID, error) {
+	u := UUID{}
+	if _, err := rand.Read(u[6:]); err != nil {
+		return UUID{}, err
+	}
+	millis, counter := v7Clock.next(uint16(u[6])<<8 | uint16(u[7]))
+
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], millis)
+	copy(u[0:6], timestamp[2:])
+	u[6] = byte(counter >> 8)
+	u[7] = byte(counter)
+	u.setVersion(7)
 	return u, nil
 }
+
+func (u *UUID) setVersion(version byte) {
+	u[6] = (u[6] & 0x0f) | version<<4
+	// the RFC 4122 variant
+	u[8] = (u[8] & 0x3f) | 0x80
+}
+
+// v7Clock hands out the timestamps and counters of version 7 UUIDs.
+var v7Clock = &monotonicClock{now: time.Now}
+
+type monotonicClock struct {
+	now func() time.Time
+
+	mutex   sync.Mutex
+	millis  uint64
+	counter uint16
+}
+
+// counterMask selects the 12 bits of the counter.
+const counterMask = 0x0fff
+
+// next returns the timestamp and counter for a new UUID. The counter starts
+// at a random value in the lower half of its range each millisecond, which
+// leaves room for increments.
+func (c *monotonicClock) next(random uint16) (uint64, uint16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	millis := uint64(c.now().UnixNano() / int64(time.Millisecond))
+	if millis > c.millis {
+		c.millis = millis
+		c.counter = random & (counterMask >> 1)
+		return c.millis, c.counter
+	}
+	if c.counter == counterMask {
+		// the counter is exhausted, borrow from the next millisecond
+		c.millis++
+		c.counter = random & (counterMask >> 1)
+		return c.millis, c.counter
+	}
+	c.counter++
+	return c.millis, c.counter
+}
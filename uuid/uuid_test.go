@@ -1,7 +1,9 @@
 package uuid_test
 
 import (
+	"encoding/json"
 	"sync"
+	"time"
 
 	. "github.com/SAP/aker/uuid"
 
@@ -38,6 +40,13 @@ var _ = Describe("UUID", func() {
 			Ω(uid.String()).Should(HaveLen(36))
 		})
 
+		It("should set the version and variant", func() {
+			uid, err := Random()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(uid.Version()).Should(Equal(4))
+			Ω(uid[8] >> 6).Should(Equal(byte(2)))
+		})
+
 		It("should return random UUID", func() {
 			first, err := Random()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -48,6 +57,94 @@ var _ = Describe("UUID", func() {
 		})
 	})
 
+	Describe("NewV7", func() {
+		It("should set the version and variant", func() {
+			uid, err := NewV7()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(uid.Version()).Should(Equal(7))
+			Ω(uid[8] >> 6).Should(Equal(byte(2)))
+		})
+
+		It("should start with the current Unix time in milliseconds", func() {
+			before := time.Now().UnixNano() / int64(time.Millisecond)
+			uid, err := NewV7()
+			Ω(err).ShouldNot(HaveOccurred())
+			millis := int64(uid[0])<<40 | int64(uid[1])<<32 | int64(uid[2])<<24 |
+				int64(uid[3])<<16 | int64(uid[4])<<8 | int64(uid[5])
+			Ω(millis).Should(BeNumerically("~", before, 1000))
+		})
+
+		It("should generate strictly increasing UUIDs", func() {
+			previous, err := NewV7()
+			Ω(err).ShouldNot(HaveOccurred())
+			for i := 0; i < 10000; i++ {
+				next, err := NewV7()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(previous.String() < next.String()).Should(BeTrue())
+				previous = next
+			}
+		})
+	})
+
+	DescribeTable("Parse", func(input string) {
+		uid, err := Parse(input)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(uid).Should(Equal(UUID{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1,
+			0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}))
+	},
+		Entry("canonical", "6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Entry("upper case", "6BA7B810-9DAD-11D1-80B4-00C04FD430C8"),
+		Entry("URN", "urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Entry("upper case URN", "URN:UUID:6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Entry("braces", "{6ba7b810-9dad-11d1-80b4-00c04fd430c8}"),
+		Entry("no hyphens", "6ba7b8109dad11d180b400c04fd430c8"),
+	)
+
+	DescribeTable("Parse invalid", func(input string) {
+		_, err := Parse(input)
+		Ω(err).Should(Equal(InvalidFormatError(input)))
+	},
+		Entry("empty", ""),
+		Entry("short", "6ba7b810-9dad-11d1-80b4-00c04fd430c"),
+		Entry("misplaced hyphen", "6ba7b8109-dad-11d1-80b4-00c04fd430c8"),
+		Entry("non hex digit", "6ba7b810-9dad-11d1-80b4-00c04fd430cg"),
+		Entry("unbalanced brace", "{6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Entry("braced URN", "{urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8}"),
+	)
+
+	Describe("MustParse", func() {
+		It("should return the parsed UUID", func() {
+			Ω(MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8").String()).Should(Equal("6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+		})
+
+		It("should panic on invalid input", func() {
+			Ω(func() { MustParse("invalid") }).Should(Panic())
+		})
+	})
+
+	Describe("encoding", func() {
+		type document struct {
+			ID UUID `json:"id"`
+		}
+
+		It("should marshal to a JSON string", func() {
+			data, err := json.Marshal(document{ID: MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(data).Should(MatchJSON(`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}`))
+		})
+
+		It("should unmarshal from a JSON string", func() {
+			var doc document
+			Ω(json.Unmarshal([]byte(`{"id": "urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8"}`), &doc)).Should(Succeed())
+			Ω(doc.ID.String()).Should(Equal("6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+		})
+
+		It("should fail to unmarshal an invalid UUID", func() {
+			var doc document
+			Ω(json.Unmarshal([]byte(`{"id": "invalid"}`), &doc)).ShouldNot(Succeed())
+		})
+	})
+
 	Measure("Performance", func(b Benchmarker) {
 		b.Time("runtime", func() {
 			wait := &sync.WaitGroup{}